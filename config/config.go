@@ -12,6 +12,9 @@ import (
 //Config holds the config for this load test
 var Config models.Configuration
 
+//Raw holds the config file as is, to be saved along with the results
+var Raw json.RawMessage
+
 func init() {
 	Config = models.Configuration{}
 }
@@ -43,5 +46,7 @@ func SetConfig() {
 		if err != nil {
 			panic(err)
 		}
+
+		Raw = jsonConfig
 	}
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/phantomvivek/kratos/config"
 	"github.com/phantomvivek/kratos/service"
 )
@@ -13,6 +15,12 @@ func init() {
 
 func main() {
 
+	//Saved results & event logs are reported without running tests
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		service.RunReport(os.Args[2:])
+		return
+	}
+
 	service.TestRunner.Initialize()
 
 	service.TestRunner.Start()
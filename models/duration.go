@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+//Duration is a time duration in config, either as a number of seconds or a string like "250ms" or "1.5s"
+type Duration time.Duration
+
+//UnmarshalJSON reads the duration from a number of seconds or a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+
+	var val interface{}
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+
+	switch value := val.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case string:
+		dur, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(dur)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+
+	return nil
+}
+
+//ParseDuration parses a number of seconds or a duration string
+func ParseDuration(value string) (Duration, error) {
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return Duration(seconds * float64(time.Second)), nil
+	}
+
+	dur, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	return Duration(dur), nil
+}
+
+//MarshalJSON writes the duration as a duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
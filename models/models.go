@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"regexp"
 	"time"
 
 	"github.com/influxdata/tdigest"
@@ -9,11 +10,45 @@ import (
 
 //Configuration for incoming config
 type Configuration struct {
-	Config   ConnectionConfig `json:"config"`
-	HitRates []HitRate        `json:"hitrate"`
-	Tests    []Test           `json:"tests"`
-	DataFile string           `json:"dataFile,omitempty"`
-	Reporter ReporterConfig   `json:"reporter"`
+	Config         ConnectionConfig `json:"config"`
+	HitRates       []HitRate        `json:"hitrate"`
+	Concurrency    []HitRate        `json:"concurrency,omitempty"`
+	Tests          []Test           `json:"tests"`
+	Scenarios      []Scenario       `json:"scenarios,omitempty"`
+	DataFile       string           `json:"dataFile,omitempty"`
+	Reporter       ReporterConfig   `json:"reporter"`
+	StepDelay      *Duration        `json:"stepDelay,omitempty"`
+	Hold           *Duration        `json:"hold,omitempty"`
+	GracePeriod    *Duration        `json:"gracePeriod,omitempty"`
+	StopConditions []*StopCondition `json:"stopConditions,omitempty"`
+	Output         OutputConfig     `json:"output,omitempty"`
+}
+
+//Scenario is a weighted set of tests, every connection runs the tests of one scenario
+type Scenario struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Tests  []*Test `json:"tests"`
+}
+
+//StopCondition stops the test early when its threshold is crossed
+type StopCondition struct {
+	Type           string   `json:"type"`
+	Percent        float64  `json:"percent,omitempty"`
+	Window         Duration `json:"window,omitempty"`
+	Latency        Duration `json:"latency,omitempty"`
+	Quantile       float64  `json:"quantile,omitempty"`
+	Count          int      `json:"count,omitempty"`
+	MinConnections int      `json:"minConnections,omitempty"`
+}
+
+//OutputConfig to write results to files
+type OutputConfig struct {
+	JSON         string    `json:"json,omitempty"`
+	Events       string    `json:"events,omitempty"`
+	EventsFormat string    `json:"eventsFormat,omitempty"`
+	HTML         string    `json:"html,omitempty"`
+	Quantiles    []float64 `json:"quantiles,omitempty"`
 }
 
 //ReporterConfig to read the reporting config
@@ -26,8 +61,33 @@ type ReporterConfig struct {
 
 //ConnectionConfig will contain URL & related parameters
 type ConnectionConfig struct {
-	URL     string `json:"url"`
-	Timeout int    `json:"timeout,omitempty"`
+	URL              string            `json:"url"`
+	Timeout          int               `json:"timeout,omitempty"`
+	HandshakeTimeout int               `json:"handshakeTimeout,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	Subprotocols     []string          `json:"subprotocols,omitempty"`
+	Origin           string            `json:"origin,omitempty"`
+	Cookies          map[string]string `json:"cookies,omitempty"`
+	TLS              *TLSConfig        `json:"tls,omitempty"`
+	Compression      bool              `json:"compression,omitempty"`
+	CompressionLevel int               `json:"compressionLevel,omitempty"`
+}
+
+//TLSConfig holds the TLS client options for wss:// hosts
+type TLSConfig struct {
+	CAFile             string       `json:"caFile,omitempty"`
+	CertFile           string       `json:"certFile,omitempty"`
+	KeyFile            string       `json:"keyFile,omitempty"`
+	ClientCerts        []ClientCert `json:"clientCerts,omitempty"`
+	ServerName         string       `json:"serverName,omitempty"`
+	MinVersion         string       `json:"minVersion,omitempty"`
+	InsecureSkipVerify bool         `json:"insecureSkipVerify,omitempty"`
+}
+
+//ClientCert is a client certificate & key pair used for mutual TLS
+type ClientCert struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
 }
 
 //HitRate defines a rate of hitting the test applicant with connections
@@ -40,17 +100,67 @@ type HitRate struct {
 
 //Test type is used for sending messages
 type Test struct {
-	Type       string          `json:"type"`
-	Duration   int             `json:"duration,omitempty"`
-	SendJSON   json.RawMessage `json:"send,omitempty"`
-	ReplaceStr bool            `json:"replace,omitempty"`
-	Data       *TestData       `json:"testdata,omitempty"`
+	Type         string             `json:"type"`
+	Duration     Duration           `json:"duration,omitempty"`
+	Think        *ThinkTime         `json:"think,omitempty"`
+	SendJSON     json.RawMessage    `json:"send,omitempty"`
+	ReplaceStr   bool               `json:"replace,omitempty"`
+	Data         *TestData          `json:"testdata,omitempty"`
+	Expect       *Matcher           `json:"expect,omitempty"`
+	Extract      []*Extractor       `json:"extract,omitempty"`
+	Timeout      int                `json:"timeout,omitempty"`
+	Base64       string             `json:"base64,omitempty"`
+	Hex          string             `json:"hex,omitempty"`
+	File         string             `json:"file,omitempty"`
+	ReplaceBytes []*ByteReplacement `json:"replaceBytes,omitempty"`
+	PingPayload  string             `json:"payload,omitempty"`
+	PingInterval Duration           `json:"pingInterval,omitempty"`
+	CloseCode    int                `json:"code,omitempty"`
+	CloseReason  string             `json:"reason,omitempty"`
+	Steps        []*Test            `json:"steps,omitempty"`
+	Count        int                `json:"count,omitempty"`
+	Variables    []*VariableConfig  `json:"-"`
+	Payload      []byte             `json:"-"`
+}
+
+//ThinkTime draws a random sleep duration from a distribution
+type ThinkTime struct {
+	Distribution string   `json:"distribution"`
+	Min          Duration `json:"min,omitempty"`
+	Max          Duration `json:"max,omitempty"`
+	Mean         Duration `json:"mean,omitempty"`
+	StdDev       Duration `json:"stddev,omitempty"`
+}
+
+//ByteReplacement replaces a byte range of a binary payload with data from a CSV column
+type ByteReplacement struct {
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length,omitempty"`
+	Column   int    `json:"column"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+//Matcher is used to match a message received from the host
+type Matcher struct {
+	Type  string         `json:"type"`
+	Value string         `json:"value"`
+	Regex *regexp.Regexp `json:"-"`
+}
+
+//Extractor captures a value from a message received from the host into a connection variable
+type Extractor struct {
+	Variable string         `json:"var"`
+	JSONPath string         `json:"json,omitempty"`
+	Regex    string         `json:"regex,omitempty"`
+	Group    *int           `json:"group,omitempty"`
+	RegexRef *regexp.Regexp `json:"-"`
 }
 
 //TestData will hold all the constructed messages after replacing variables from file
 type TestData struct {
-	Counter   int               `json:"counter"`
-	DataArray []json.RawMessage `json:"messageArray"`
+	Counter     int               `json:"counter"`
+	DataArray   []json.RawMessage `json:"messageArray"`
+	BinaryArray [][]byte          `json:"binaryArray"`
 }
 
 //TestDataConfig saves a config for replacing a particular column from csv in the message
@@ -59,6 +169,12 @@ type TestDataConfig struct {
 	TextBytes []byte
 }
 
+//VariableConfig saves a config for replacing a connection variable in the message
+type VariableConfig struct {
+	Name      string
+	TextBytes []byte
+}
+
 //ConnectionBucket this has a per second count and incremented by previous second
 type ConnectionBucket struct {
 	Idx         int     `json:"index"`
@@ -66,19 +182,61 @@ type ConnectionBucket struct {
 	IncrementBy float64 `json:"incrBy"`
 }
 
+//ConnectEvent is the outcome of a connect, sent as soon as the socket connects or fails to, before its tests are run
+type ConnectEvent struct {
+	At           time.Time
+	HitrateIndex int
+	Scenario     string
+	Success      bool
+	Timeout      bool
+	ConnectTime  time.Duration
+}
+
 //SocketStats used to measure timing stats
 type SocketStats struct {
-	HitrateIndex      int           `json:"hrIdx"`
-	ConnectTime       time.Duration `json:"connecttime"`
-	DNSResolutionTime time.Duration `json:"dnstime"`
-	OverallTime       time.Duration `json:"overalltime"`
-	Success           bool          `json:"success"`
-	ErrorString       string        `json:"error"`
+	ConnectionID      int             `json:"id"`
+	Timestamp         time.Time       `json:"timestamp"`
+	HitrateIndex      int             `json:"hrIdx"`
+	Scenario          string          `json:"scenario"`
+	ConnectTime       time.Duration   `json:"connecttime"`
+	DNSResolutionTime time.Duration   `json:"dnstime"`
+	OverallTime       time.Duration   `json:"overalltime"`
+	TLSHandshakeTime  time.Duration   `json:"tlstime"`
+	UpgradeTime       time.Duration   `json:"upgradetime"`
+	Success           bool            `json:"success"`
+	Timeout           bool            `json:"timeout"`
+	StatusCode        int             `json:"statuscode,omitempty"`
+	ErrorString       string          `json:"error"`
+	ExpectMatch       int             `json:"expectmatch"`
+	ExpectMismatch    int             `json:"expectmismatch"`
+	ExpectTimeout     int             `json:"expecttimeout"`
+	ExtractSuccess    int             `json:"extractsuccess"`
+	ExtractFailure    int             `json:"extractfailure"`
+	RoundTripTimes    []time.Duration `json:"roundtriptimes"`
+	PingTimes         []time.Duration `json:"pingtimes"`
+	PingTimeouts      int             `json:"pingtimeouts"`
+	CloseTime         time.Duration   `json:"closetime"`
+	CloseTimeout      bool            `json:"closetimeout"`
+	ServerCloseCode   int             `json:"serverclosecode,omitempty"`
+	Iterations        int             `json:"iterations"`
+	Held              bool            `json:"held"`
+	HoldDropped       bool            `json:"holddropped"`
+	MessagesSent      int64           `json:"msgssent"`
+	BytesSent         int64           `json:"bytessent"`
+	SendFailures      int64           `json:"sendfailures"`
+	MessagesReceived  int64           `json:"msgsreceived"`
+	BytesReceived     int64           `json:"bytesreceived"`
+	ReadErrors        int64           `json:"readerrors"`
+	Compressed        bool            `json:"compressed"`
+	WireBytesSent     int64           `json:"wirebytessent"`
+	WireBytesReceived int64           `json:"wirebytesreceived"`
 }
 
 //HitRateStats will store all stats related to this particular hit rate
 type HitRateStats struct {
 	HitRateRef              *HitRate
+	Reported                bool
+	ScenarioRef             *Scenario
 	TotalConnections        int
 	TotalDuration           time.Duration
 	ConnectSuccess          float64
@@ -93,5 +251,41 @@ type HitRateStats struct {
 	OverallLatencies        *tdigest.TDigest
 	OverallLatencyMin       float64
 	OverallLatencyMax       float64
+	TLSHandshakeLatencies   *tdigest.TDigest
+	TLSHandshakeLatencyMin  float64
+	TLSHandshakeLatencyMax  float64
+	UpgradeLatencies        *tdigest.TDigest
+	UpgradeLatencyMin       float64
+	UpgradeLatencyMax       float64
+	RoundTripLatencies      *tdigest.TDigest
+	RoundTripLatencyMin     float64
+	RoundTripLatencyMax     float64
+	PingLatencies           *tdigest.TDigest
+	PingLatencyMin          float64
+	PingLatencyMax          float64
+	PingTimeouts            int
+	CloseLatencies          *tdigest.TDigest
+	CloseLatencyMin         float64
+	CloseLatencyMax         float64
+	CloseTimeouts           int
+	Iterations              int
+	Held                    int
+	HoldDrops               int
+	ExpectMatch             int
+	ExpectMismatch          int
+	ExpectTimeout           int
+	ExtractSuccess          int
+	ExtractFailure          int
+	MessagesSent            int64
+	BytesSent               int64
+	SendFailures            int64
+	MessagesReceived        int64
+	BytesReceived           int64
+	ReadErrors              int64
+	CompressedConnections   int
+	WireBytesSent           int64
+	WireBytesReceived       int64
 	ErrorSet                map[string]int
+	StatusCodes             map[int]int
+	CloseCodes              map[int]int
 }
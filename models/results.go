@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//ResultsSchemaVersion is the version of the results file, bumped on changes that break readers
+const ResultsSchemaVersion = 1
+
+//Results is the results file written at the end of the test
+type Results struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Run           RunInfo          `json:"run"`
+	Config        json.RawMessage  `json:"config"`
+	Quantiles     []float64        `json:"quantiles"`
+	HitRates      []HitRateResult  `json:"hitrates"`
+	Scenarios     []ScenarioResult `json:"scenarios"`
+	All           ResultStats      `json:"all"`
+}
+
+//RunInfo is the metadata of the test run
+type RunInfo struct {
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Mode            string    `json:"mode"`
+	Stopped         bool      `json:"stopped"`
+	StopReason      string    `json:"stopReason,omitempty"`
+}
+
+//HitRateResult is the results of a hitrate, or a concurrency stage
+type HitRateResult struct {
+	Index           int         `json:"index"`
+	Start           float64     `json:"start"`
+	End             float64     `json:"end"`
+	DurationSeconds int         `json:"durationSeconds"`
+	Stats           ResultStats `json:"stats"`
+}
+
+//ScenarioResult is the results of a scenario
+type ScenarioResult struct {
+	Name   string      `json:"name"`
+	Weight float64     `json:"weight"`
+	Stats  ResultStats `json:"stats"`
+}
+
+//ResultStats is the counts & latencies of a set of connections
+type ResultStats struct {
+	DurationSeconds float64                  `json:"durationSeconds"`
+	Connections     ConnectionResults        `json:"connections"`
+	Expect          ExpectResults            `json:"expect"`
+	Extract         ExtractResults           `json:"extract"`
+	Messages        MessageResults           `json:"messages"`
+	Iterations      int                      `json:"iterations"`
+	Hold            HoldResults              `json:"hold"`
+	PingTimeouts    int                      `json:"pingTimeouts"`
+	CloseTimeouts   int                      `json:"closeTimeouts"`
+	Latencies       map[string]LatencyResult `json:"latencies"`
+	StatusCodes     map[int]int              `json:"statusCodes"`
+	CloseCodes      map[int]int              `json:"closeCodes"`
+	Errors          map[string]int           `json:"errors"`
+}
+
+//ConnectionResults is the outcome of connections
+type ConnectionResults struct {
+	Total      int `json:"total"`
+	Success    int `json:"success"`
+	Failure    int `json:"failure"`
+	Timeout    int `json:"timeout"`
+	Compressed int `json:"compressed"`
+}
+
+//ExpectResults is the outcome of expected messages
+type ExpectResults struct {
+	Match    int `json:"match"`
+	Mismatch int `json:"mismatch"`
+	Timeout  int `json:"timeout"`
+}
+
+//ExtractResults is the outcome of extractors
+type ExtractResults struct {
+	Success int `json:"success"`
+	Failure int `json:"failure"`
+}
+
+//MessageResults is the counts of messages & bytes sent & received
+type MessageResults struct {
+	Sent              int64 `json:"sent"`
+	BytesSent         int64 `json:"bytesSent"`
+	SendFailures      int64 `json:"sendFailures"`
+	Received          int64 `json:"received"`
+	BytesReceived     int64 `json:"bytesReceived"`
+	ReadErrors        int64 `json:"readErrors"`
+	WireBytesSent     int64 `json:"wireBytesSent"`
+	WireBytesReceived int64 `json:"wireBytesReceived"`
+}
+
+//HoldResults is the outcome of held connections
+type HoldResults struct {
+	Held    int `json:"held"`
+	Dropped int `json:"dropped"`
+}
+
+//LatencyResult is a latency in milliseconds, with the quantiles keyed like "p99" & the number of times it was measured
+type LatencyResult struct {
+	Count     int                `json:"count"`
+	Min       float64            `json:"min"`
+	Max       float64            `json:"max"`
+	Quantiles map[string]float64 `json:"quantiles"`
+}
@@ -2,11 +2,17 @@ package service
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -96,17 +102,45 @@ func (d *DataHandler) ConstructDataConfig(message json.RawMessage) []*models.Tes
 	return configs
 }
 
-//PrepareTestData prepares the test data for each test
-func (d *DataHandler) PrepareTestData(file string, connCount int, tests []*models.Test) int {
+//ConstructVariableConfig finds the connection variables which need to be replaced in the test message string
+func (d *DataHandler) ConstructVariableConfig(message json.RawMessage) []*models.VariableConfig {
 
-	if file == "" {
-		return 0
+	reg := regexp.MustCompile(`\${(.*?)}`)
+	byteArr := reg.FindAll(message, -1)
+
+	configs := make([]*models.VariableConfig, 0)
+
+	for _, val := range byteArr {
+		//Numeric names are CSV columns, everything else is a variable captured from the app responses
+		name := strings.TrimLeft(strings.TrimRight(string(val), "}"), "${")
+		if _, err := strconv.Atoi(name); err == nil || name == "" {
+			continue
+		}
+
+		configs = append(configs, &models.VariableConfig{
+			Name:      name,
+			TextBytes: val,
+		})
 	}
 
-	//Get file data
-	data, err := d.GetCSVData(file, connCount)
-	if err != nil {
-		panic(err)
+	return configs
+}
+
+//PrepareVariables prepares the connection variable configs for each test that replaces strings
+func (d *DataHandler) PrepareVariables(tests []*models.Test) {
+
+	for _, test := range tests {
+		if test.ReplaceStr {
+			test.Variables = d.ConstructVariableConfig(test.SendJSON)
+		}
+	}
+}
+
+//PrepareTestData prepares the test data for each test
+func (d *DataHandler) PrepareTestData(data [][]string, tests []*models.Test) int {
+
+	if len(data) == 0 {
+		return 0
 	}
 
 	var maxLen int
@@ -140,7 +174,179 @@ func (d *DataHandler) PrepareTestData(file string, connCount int, tests []*model
 
 			maxLen = len(jsonMessages)
 		}
+
+		if test.Type == "binary" && len(test.ReplaceBytes) > 0 {
+
+			binaryMessages := make([][]byte, 0, len(data))
+			for _, strData := range data {
+				binaryMessages = append(binaryMessages, d.ReplacePayloadBytes(test.Payload, test.ReplaceBytes, strData))
+			}
+
+			test.Data = &models.TestData{
+				Counter:     0,
+				BinaryArray: binaryMessages,
+			}
+
+			maxLen = len(binaryMessages)
+		}
 	}
 
 	return maxLen
 }
+
+//PreparePayloads decodes the payload of binary tests from base64, hex or a file, only one of which can be set
+func (d *DataHandler) PreparePayloads(tests []*models.Test) error {
+
+	for _, test := range tests {
+		if test.Type != "binary" {
+			continue
+		}
+
+		sources := 0
+		for _, source := range []string{test.Base64, test.Hex, test.File} {
+			if source != "" {
+				sources++
+			}
+		}
+
+		if sources != 1 {
+			return fmt.Errorf("binary test needs exactly one of base64, hex or file, found: %v", sources)
+		}
+
+		var err error
+		if test.Base64 != "" {
+			test.Payload, err = base64.StdEncoding.DecodeString(test.Base64)
+		} else if test.Hex != "" {
+			test.Payload, err = hex.DecodeString(test.Hex)
+		} else if test.File != "" {
+			test.Payload, err = ioutil.ReadFile(test.File)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//ReplacePayloadBytes replaces byte ranges of the payload with the CSV column values of a data row
+func (d *DataHandler) ReplacePayloadBytes(payload []byte, replacements []*models.ByteReplacement, strData []string) []byte {
+
+	//Replace from the end, so offsets of the original payload stay valid when a replacement changes the length
+	sorted := make([]*models.ByteReplacement, len(replacements))
+	copy(sorted, replacements)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Offset > sorted[j].Offset
+	})
+
+	msg := payload
+	for _, replacement := range sorted {
+		if len(strData) <= replacement.Column {
+			continue
+		}
+
+		var value []byte
+		var err error
+		switch replacement.Encoding {
+		case "hex":
+			value, err = hex.DecodeString(strings.TrimSpace(strData[replacement.Column]))
+		case "base64":
+			value, err = base64.StdEncoding.DecodeString(strings.TrimSpace(strData[replacement.Column]))
+		default:
+			value = []byte(strData[replacement.Column])
+		}
+
+		if err != nil {
+			panic(err)
+		}
+
+		//Defaults to overwriting as many bytes as the value has
+		length := replacement.Length
+		if length == 0 {
+			length = len(value)
+		}
+
+		if replacement.Offset < 0 || replacement.Offset > len(msg) {
+			panic(fmt.Sprintf("Replace bytes offset %v is out of range of the payload", replacement.Offset))
+		}
+
+		end := replacement.Offset + length
+		if end > len(msg) {
+			end = len(msg)
+		}
+
+		replaced := make([]byte, 0, len(msg)-(end-replacement.Offset)+len(value))
+		replaced = append(replaced, msg[:replacement.Offset]...)
+		replaced = append(replaced, value...)
+		replaced = append(replaced, msg[end:]...)
+		msg = replaced
+	}
+
+	return msg
+}
+
+//PrepareHeaders prepares the request headers for the connections, one per data row if any header uses CSV data
+func (d *DataHandler) PrepareHeaders(data [][]string, connConfig models.ConnectionConfig) []http.Header {
+
+	values := make(map[string]string)
+	for key, val := range connConfig.Headers {
+		values[key] = val
+	}
+
+	if connConfig.Origin != "" {
+		values["Origin"] = connConfig.Origin
+	}
+
+	if len(connConfig.Cookies) > 0 {
+		names := make([]string, 0, len(connConfig.Cookies))
+		for name := range connConfig.Cookies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		cookies := make([]string, 0, len(names))
+		for _, name := range names {
+			cookies = append(cookies, name+"="+connConfig.Cookies[name])
+		}
+		values["Cookie"] = strings.Join(cookies, "; ")
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	//Prepare the configs for replacing CSV data in header values
+	configs := make(map[string][]*models.TestDataConfig)
+	for key, val := range values {
+		if valConfigs := d.ConstructDataConfig(json.RawMessage(val)); len(valConfigs) > 0 {
+			configs[key] = valConfigs
+		}
+	}
+
+	if len(configs) == 0 || len(data) == 0 {
+		header := http.Header{}
+		for key, val := range values {
+			header.Set(key, val)
+		}
+		return []http.Header{header}
+	}
+
+	headers := make([]http.Header, 0, len(data))
+	for _, strData := range data {
+
+		header := http.Header{}
+		for key, val := range values {
+			for _, config := range configs[key] {
+				if len(strData) > config.ColumnIdx {
+					val = strings.Replace(val, string(config.TextBytes), strData[config.ColumnIdx], -1)
+				}
+			}
+			header.Set(key, val)
+		}
+
+		headers = append(headers, header)
+	}
+
+	return headers
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//EventLogSize is the number of metrics buffered for the event log writer
+const EventLogSize = 16384
+
+//EventBufferSize is the size of the buffer between the event log writer & the file
+const EventBufferSize = 1 << 16
+
+//EventColumns are the columns of the CSV event log, named like the keys of the NDJSON event log
+var EventColumns = []string{
+	"id", "timestamp", "hrIdx", "scenario",
+	"connecttime", "dnstime", "overalltime", "tlstime", "upgradetime",
+	"success", "timeout", "statuscode", "error",
+	"expectmatch", "expectmismatch", "expecttimeout", "extractsuccess", "extractfailure",
+	"roundtriptimes", "pingtimes", "pingtimeouts", "closetime", "closetimeout", "serverclosecode",
+	"iterations", "held", "holddropped",
+	"msgssent", "bytessent", "sendfailures", "msgsreceived", "bytesreceived", "readerrors",
+	"compressed", "wirebytessent", "wirebytesreceived",
+}
+
+//EventLog streams the metric of every connection to a file, as NDJSON or CSV
+type EventLog struct {
+	Format    string
+	File      *os.File
+	Writer    *bufio.Writer
+	CSVWriter *csv.Writer
+	Encoder   *json.Encoder
+	Events    chan *models.SocketStats
+	Done      chan struct{}
+}
+
+//NewEventLog makes an event log writing to the file at the path
+func NewEventLog(path string, format string) *EventLog {
+
+	if format == "" {
+		//Defaults to NDJSON
+		format = "ndjson"
+	}
+
+	if format != "ndjson" && format != "csv" {
+		panic(fmt.Sprintf("Invalid events format found: %s", format))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+
+	eventLog := &EventLog{
+		Format: format,
+		File:   file,
+		Writer: bufio.NewWriterSize(file, EventBufferSize),
+		Events: make(chan *models.SocketStats, EventLogSize),
+		Done:   make(chan struct{}),
+	}
+
+	if format == "csv" {
+		eventLog.CSVWriter = csv.NewWriter(eventLog.Writer)
+		eventLog.CSVWriter.Write(EventColumns)
+	} else {
+		eventLog.Encoder = json.NewEncoder(eventLog.Writer)
+	}
+
+	return eventLog
+}
+
+//Start writes metrics to the file till the event log is closed
+func (e *EventLog) Start() {
+
+	defer close(e.Done)
+
+	for metric := range e.Events {
+		var err error
+		if e.CSVWriter != nil {
+			err = e.CSVWriter.Write(EventRecord(metric))
+		} else {
+			err = e.Encoder.Encode(metric)
+		}
+
+		if err != nil {
+			fmt.Println("Error writing event", err)
+		}
+	}
+
+	if e.CSVWriter != nil {
+		e.CSVWriter.Flush()
+	}
+
+	if err := e.Writer.Flush(); err != nil {
+		fmt.Println("Error writing events", err)
+	}
+
+	if err := e.File.Close(); err != nil {
+		fmt.Println("Error closing events", err)
+	}
+}
+
+//Log queues the metric to be written
+func (e *EventLog) Log(metric *models.SocketStats) {
+	e.Events <- metric
+}
+
+//Close writes the metrics queued & closes the file
+func (e *EventLog) Close() {
+	close(e.Events)
+	<-e.Done
+}
+
+//EventRecord makes the CSV record of a metric, in the order of the event columns. Times are in nanoseconds
+func EventRecord(metric *models.SocketStats) []string {
+
+	return []string{
+		strconv.Itoa(metric.ConnectionID),
+		metric.Timestamp.Format(time.RFC3339Nano),
+		strconv.Itoa(metric.HitrateIndex),
+		metric.Scenario,
+		strconv.FormatInt(int64(metric.ConnectTime), 10),
+		strconv.FormatInt(int64(metric.DNSResolutionTime), 10),
+		strconv.FormatInt(int64(metric.OverallTime), 10),
+		strconv.FormatInt(int64(metric.TLSHandshakeTime), 10),
+		strconv.FormatInt(int64(metric.UpgradeTime), 10),
+		strconv.FormatBool(metric.Success),
+		strconv.FormatBool(metric.Timeout),
+		strconv.Itoa(metric.StatusCode),
+		metric.ErrorString,
+		strconv.Itoa(metric.ExpectMatch),
+		strconv.Itoa(metric.ExpectMismatch),
+		strconv.Itoa(metric.ExpectTimeout),
+		strconv.Itoa(metric.ExtractSuccess),
+		strconv.Itoa(metric.ExtractFailure),
+		JoinDurations(metric.RoundTripTimes),
+		JoinDurations(metric.PingTimes),
+		strconv.Itoa(metric.PingTimeouts),
+		strconv.FormatInt(int64(metric.CloseTime), 10),
+		strconv.FormatBool(metric.CloseTimeout),
+		strconv.Itoa(metric.ServerCloseCode),
+		strconv.Itoa(metric.Iterations),
+		strconv.FormatBool(metric.Held),
+		strconv.FormatBool(metric.HoldDropped),
+		strconv.FormatInt(metric.MessagesSent, 10),
+		strconv.FormatInt(metric.BytesSent, 10),
+		strconv.FormatInt(metric.SendFailures, 10),
+		strconv.FormatInt(metric.MessagesReceived, 10),
+		strconv.FormatInt(metric.BytesReceived, 10),
+		strconv.FormatInt(metric.ReadErrors, 10),
+		strconv.FormatBool(metric.Compressed),
+		strconv.FormatInt(metric.WireBytesSent, 10),
+		strconv.FormatInt(metric.WireBytesReceived, 10),
+	}
+}
+
+//JoinDurations joins durations in nanoseconds with semicolons
+func JoinDurations(durations []time.Duration) string {
+
+	values := make([]string, len(durations))
+	for idx, duration := range durations {
+		values[idx] = strconv.FormatInt(int64(duration), 10)
+	}
+
+	return strings.Join(values, ";")
+}
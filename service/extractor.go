@@ -0,0 +1,115 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//ExtractVariables runs the extractors on a message from the host and saves captured values to the socket variables
+func (s *Socket) ExtractVariables(extractors []*models.Extractor, msg []byte) {
+
+	for _, extractor := range extractors {
+
+		var value []byte
+		var ok bool
+
+		if extractor.RegexRef != nil {
+			value, ok = ExtractRegex(extractor, msg)
+		} else if extractor.JSONPath != "" {
+			value, ok = ExtractJSONPath(extractor.JSONPath, msg)
+		}
+
+		if !ok {
+			s.SocketStats.ExtractFailure++
+			continue
+		}
+
+		s.Variables[extractor.Variable] = value
+		s.SocketStats.ExtractSuccess++
+	}
+}
+
+//ExtractRegex returns the capture group of the extractor regex from the message
+func ExtractRegex(extractor *models.Extractor, msg []byte) ([]byte, bool) {
+
+	matches := extractor.RegexRef.FindSubmatch(msg)
+	if matches == nil {
+		return nil, false
+	}
+
+	//Defaults to the first capture group, or the whole match if the regex has no groups
+	group := 1
+	if extractor.Group != nil {
+		group = *extractor.Group
+	} else if len(matches) == 1 {
+		group = 0
+	}
+
+	if group < 0 || group >= len(matches) {
+		return nil, false
+	}
+
+	return matches[group], true
+}
+
+//ExtractJSONPath returns the value at a dot separated path (eg: data.items.0.token) from a JSON message
+func ExtractJSONPath(path string, msg []byte) ([]byte, bool) {
+
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber()
+
+	var node interface{}
+	if err := decoder.Decode(&node); err != nil {
+		return nil, false
+	}
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch val := node.(type) {
+			case map[string]interface{}:
+				child, ok := val[key]
+				if !ok {
+					return nil, false
+				}
+				node = child
+			case []interface{}:
+				idx, err := strconv.Atoi(key)
+				if err != nil || idx < 0 || idx >= len(val) {
+					return nil, false
+				}
+				node = val[idx]
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	//Strings are used as is, everything else is used as its JSON representation
+	if str, ok := node.(string); ok {
+		return []byte(str), true
+	}
+
+	value, err := json.Marshal(node)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+//ReplaceVariables replaces connection variables referenced in the message with their captured values
+func (s *Socket) ReplaceVariables(msg []byte, configs []*models.VariableConfig) []byte {
+
+	for _, config := range configs {
+		if value, ok := s.Variables[config.Name]; ok {
+			msg = bytes.Replace(msg, config.TextBytes, value, -1)
+		}
+	}
+
+	return msg
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/tdigest"
+	"github.com/phantomvivek/kratos/config"
+	"github.com/phantomvivek/kratos/models"
+)
+
+//ChartColors are the colors of the series of a chart, in order
+var ChartColors = []string{"#2b6cb0", "#c05621", "#2f855a", "#9b2c2c"}
+
+//TimeBucket is the stats of connections opened in a second of the test
+type TimeBucket struct {
+	Opened           int
+	Success          int
+	Failure          int
+	ConnectLatencies *tdigest.TDigest
+	OverallLatencies *tdigest.TDigest
+}
+
+//ChartSeries is a line of a chart, NaN values are gaps in the line
+type ChartSeries struct {
+	Name   string
+	Values []float64
+}
+
+//HTMLSection is a table of the report, like the results of a hitrate
+type HTMLSection struct {
+	Title string
+	Rows  [][]string
+}
+
+//HTMLError is an error with its count
+type HTMLError struct {
+	Error string
+	Count int
+}
+
+//HTMLReport is the data of the HTML report
+type HTMLReport struct {
+	Title      string
+	URL        string
+	StartTime  string
+	Duration   string
+	StopReason string
+	Charts     []template.HTML
+	Sections   []HTMLSection
+	Errors     []HTMLError
+}
+
+//AddToTimeline adds the metric to the bucket of the second its connection was opened in
+func (r *StatsReporter) AddToTimeline(metric *models.SocketStats) {
+
+	second := int(metric.Timestamp.Sub(r.StartTime) / time.Second)
+	if second < 0 {
+		second = 0
+	}
+
+	for len(r.Timeline) <= second {
+		r.Timeline = append(r.Timeline, &TimeBucket{
+			ConnectLatencies: tdigest.NewWithCompression(100),
+			OverallLatencies: tdigest.NewWithCompression(100),
+		})
+	}
+
+	bucket := r.Timeline[second]
+	bucket.Opened++
+
+	if !metric.Success {
+		bucket.Failure++
+		return
+	}
+
+	bucket.Success++
+	bucket.ConnectLatencies.Add(float64(metric.ConnectTime), 1)
+	bucket.OverallLatencies.Add(float64(metric.OverallTime), 1)
+}
+
+//WriteHTML writes the HTML report of the test, with charts over time, tables per hitrate & the errors
+func (r *StatsReporter) WriteHTML(path string) {
+
+	report := HTMLReport{
+		Title:      "kratos report",
+		URL:        config.Config.Config.URL,
+		StartTime:  r.StartTime.Format(time.RFC1123),
+		Duration:   r.AllStats.TotalDuration.Round(time.Millisecond).String(),
+		StopReason: r.StopReason,
+	}
+
+	if TestRunner.Stopped() && report.StopReason == "" {
+		report.StopReason = "Interrupted"
+	}
+
+	//Charts over the seconds of the test
+	opened := make([]float64, len(r.Timeline))
+	success := make([]float64, len(r.Timeline))
+	failure := make([]float64, len(r.Timeline))
+	connect := make([][]float64, len(r.Quantiles))
+	overall := make([][]float64, len(r.Quantiles))
+	for idx := range r.Quantiles {
+		connect[idx] = make([]float64, len(r.Timeline))
+		overall[idx] = make([]float64, len(r.Timeline))
+	}
+
+	for second, bucket := range r.Timeline {
+		opened[second] = float64(bucket.Opened)
+		success[second] = float64(bucket.Success)
+		failure[second] = float64(bucket.Failure)
+		for idx, quantile := range r.Quantiles {
+			connect[idx][second] = Milliseconds(bucket.ConnectLatencies.Quantile(quantile))
+			overall[idx][second] = Milliseconds(bucket.OverallLatencies.Quantile(quantile))
+		}
+	}
+
+	connectSeries := make([]ChartSeries, len(r.Quantiles))
+	overallSeries := make([]ChartSeries, len(r.Quantiles))
+	for idx, quantile := range r.Quantiles {
+		connectSeries[idx] = ChartSeries{Name: QuantileName(quantile), Values: connect[idx]}
+		overallSeries[idx] = ChartSeries{Name: QuantileName(quantile), Values: overall[idx]}
+	}
+
+	report.Charts = []template.HTML{
+		LineChart("Connections opened per second", "connections", []ChartSeries{{Name: "opened", Values: opened}}),
+		LineChart("Success & failure per second", "connections", []ChartSeries{{Name: "success", Values: success}, {Name: "failure", Values: failure}}),
+		LineChart("Connect time", "ms", connectSeries),
+		LineChart("Overall time", "ms", overallSeries),
+	}
+
+	//Tables like the report on stdout
+	for idx := 0; idx < len(r.RateStats); idx++ {
+		hrStat := r.RateStats[idx]
+		report.Sections = append(report.Sections, HTMLSection{
+			Title: fmt.Sprintf("Hitrate %v: start=%v, end=%v, duration=%vs", idx, hrStat.HitRateRef.StartConnections, hrStat.HitRateRef.EndConnections, hrStat.HitRateRef.Duration),
+			Rows:  r.ReportRows(r.MakeResultStats(hrStat, r.Quantiles), r.Quantiles),
+		})
+	}
+
+	report.Sections = append(report.Sections, HTMLSection{
+		Title: "All Results",
+		Rows:  r.ReportRows(r.MakeResultStats(r.AllStats, r.Quantiles), r.Quantiles),
+	})
+
+	if len(r.Scenarios) > 1 {
+		for _, scenario := range r.Scenarios {
+			report.Sections = append(report.Sections, HTMLSection{
+				Title: fmt.Sprintf("Scenario %s: weight=%v", scenario.Name, scenario.Weight),
+				Rows:  r.ReportRows(r.MakeResultStats(r.ScenarioStats[scenario.Name], r.Quantiles), r.Quantiles),
+			})
+		}
+	}
+
+	//Most frequent errors first
+	for errStr, count := range r.AllStats.ErrorSet {
+		report.Errors = append(report.Errors, HTMLError{Error: errStr, Count: count})
+	}
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Count > report.Errors[j].Count
+	})
+
+	fileRef, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Error writing HTML report", err)
+		return
+	}
+	defer fileRef.Close()
+
+	if err := HTMLTemplate.Execute(fileRef, report); err != nil {
+		fmt.Println("Error writing HTML report", err)
+	}
+}
+
+//LineChart makes an SVG line chart of the series over the seconds of the test
+func LineChart(title string, unit string, series []ChartSeries) template.HTML {
+
+	const width, height = 860.0, 260.0
+	const left, right, top, bottom = 60.0, 20.0, 30.0, 40.0
+	plotWidth := width - left - right
+	plotHeight := height - top - bottom
+
+	points := 0
+	maxValue := 0.0
+	for _, line := range series {
+		if len(line.Values) > points {
+			points = len(line.Values)
+		}
+		for _, value := range line.Values {
+			if !math.IsNaN(value) && value > maxValue {
+				maxValue = value
+			}
+		}
+	}
+	maxValue = NiceCeil(maxValue)
+
+	x := func(idx int) float64 {
+		if points < 2 {
+			return left
+		}
+		return left + plotWidth*float64(idx)/float64(points-1)
+	}
+	y := func(value float64) float64 {
+		return top + plotHeight - plotHeight*value/maxValue
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %v %v" class="chart">`, width, height)
+	fmt.Fprintf(&svg, `<text x="%v" y="18" class="title">%s</text>`, left, html.EscapeString(title))
+
+	//Grid lines with values on the y axis
+	for step := 0; step <= 4; step++ {
+		value := maxValue * float64(step) / 4
+		fmt.Fprintf(&svg, `<line x1="%v" y1="%.1f" x2="%v" y2="%.1f" class="grid"/>`, left, y(value), left+plotWidth, y(value))
+		fmt.Fprintf(&svg, `<text x="%v" y="%.1f" class="axis" text-anchor="end">%s</text>`, left-6, y(value)+4, FormatValue(value))
+	}
+
+	//Seconds on the x axis
+	for step := 0; step <= 5 && points > 0; step++ {
+		idx := (points - 1) * step / 5
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%v" class="axis" text-anchor="middle">%vs</text>`, x(idx), top+plotHeight+18, idx)
+	}
+	fmt.Fprintf(&svg, `<text x="%v" y="%v" class="axis" text-anchor="end">%s</text>`, left+plotWidth, height-4, html.EscapeString(unit))
+
+	for idx, line := range series {
+		color := ChartColors[idx%len(ChartColors)]
+
+		//NaN values break the line, like seconds without successful connections for latencies
+		var path strings.Builder
+		for pos, value := range line.Values {
+			if math.IsNaN(value) {
+				if path.Len() > 0 {
+					fmt.Fprintf(&svg, `<polyline points="%s" stroke="%s" class="line"/>`, path.String(), color)
+					path.Reset()
+				}
+				continue
+			}
+			fmt.Fprintf(&path, "%.1f,%.1f ", x(pos), y(value))
+		}
+		if path.Len() > 0 {
+			fmt.Fprintf(&svg, `<polyline points="%s" stroke="%s" class="line"/>`, path.String(), color)
+		}
+
+		//Legend
+		legendX := left + plotWidth - 90*float64(len(series)-idx)
+		fmt.Fprintf(&svg, `<rect x="%.1f" y="8" width="10" height="10" fill="%s"/>`, legendX, color)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="17" class="axis">%s</text>`, legendX+14, html.EscapeString(line.Name))
+	}
+
+	svg.WriteString(`</svg>`)
+
+	return template.HTML(svg.String())
+}
+
+//NiceCeil rounds the max value of a chart up to 1, 2 or 5 times a power of 10
+func NiceCeil(value float64) float64 {
+
+	if value <= 0 {
+		return 1
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if value <= step*magnitude {
+			return step * magnitude
+		}
+	}
+
+	return 10 * magnitude
+}
+
+//FormatValue formats a value on the axis of a chart
+func FormatValue(value float64) string {
+
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+//HTMLTemplate is the HTML report, with all styles inline so it works offline
+var HTMLTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1a202c; margin: 24px auto; max-width: 900px; }
+h1 { font-size: 24px; margin-bottom: 4px; }
+h2 { font-size: 18px; margin-top: 32px; border-bottom: 1px solid #e2e8f0; padding-bottom: 4px; }
+.meta { color: #4a5568; margin: 2px 0; }
+.stopped { color: #9b2c2c; font-weight: bold; }
+.chart { width: 100%; margin: 12px 0; }
+.chart .title { font-size: 14px; font-weight: bold; fill: #1a202c; }
+.chart .axis { font-size: 11px; fill: #4a5568; }
+.chart .grid { stroke: #e2e8f0; stroke-width: 1; }
+.chart .line { fill: none; stroke-width: 2; }
+table { border-collapse: collapse; width: 100%; margin: 8px 0; font-size: 13px; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #edf2f7; }
+td.label { color: #718096; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">{{.URL}}</p>
+<p class="meta">Started {{.StartTime}}, ran for {{.Duration}}</p>
+{{if .StopReason}}<p class="meta stopped">Stopped: {{.StopReason}}</p>{{end}}
+
+<h2>Over Time</h2>
+{{range .Charts}}{{.}}
+{{end}}
+{{range .Sections}}
+<h2>{{.Title}}</h2>
+<table>
+{{range .Rows}}<tr>{{range $idx, $cell := .}}<td{{if eq $idx 1}} class="label"{{end}}>{{$cell}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+<h2>Errors</h2>
+{{if .Errors}}<table>
+<tr><th>Error</th><th>Count</th></tr>
+{{range .Errors}}<tr><td>{{.Error}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{else}}<p class="meta">No Errors</p>{{end}}
+</body>
+</html>
+`))
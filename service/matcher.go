@@ -0,0 +1,62 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//PrepareMatchers compiles the regex for every test that expects a message from the host
+func PrepareMatchers(tests []*models.Test) {
+
+	for _, test := range tests {
+
+		for _, extractor := range test.Extract {
+			if extractor.Regex == "" {
+				continue
+			}
+
+			reg, err := regexp.Compile(extractor.Regex)
+			if err != nil {
+				panic(err)
+			}
+			extractor.RegexRef = reg
+		}
+
+		if test.Expect == nil {
+			continue
+		}
+
+		if test.Expect.Type == "" {
+			//Defaults to an exact match
+			test.Expect.Type = "exact"
+		}
+
+		switch test.Expect.Type {
+		case "exact", "contains":
+		case "regex":
+			reg, err := regexp.Compile(test.Expect.Value)
+			if err != nil {
+				panic(err)
+			}
+			test.Expect.Regex = reg
+		default:
+			panic(fmt.Sprintf("Invalid expect type found: %s", test.Expect.Type))
+		}
+	}
+}
+
+//MatchMessage checks if the message received from the host satisfies the matcher
+func MatchMessage(matcher *models.Matcher, msg []byte) bool {
+
+	switch matcher.Type {
+	case "contains":
+		return bytes.Contains(msg, []byte(matcher.Value))
+	case "regex":
+		return matcher.Regex.Match(msg)
+	default:
+		return string(msg) == matcher.Value
+	}
+}
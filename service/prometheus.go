@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//PrometheusBuckets are the upper bounds of latency histograms in seconds
+var PrometheusBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//PrometheusLabels are the labels of a series, connections are counted per hitrate & scenario
+type PrometheusLabels struct {
+	Hitrate  int
+	Scenario string
+}
+
+//PrometheusHistogram is a cumulative histogram of latencies in seconds
+type PrometheusHistogram struct {
+	Buckets []int64
+	Count   int64
+	Sum     float64
+}
+
+//PrometheusSeries holds the counts & latencies of connections with the same labels
+type PrometheusSeries struct {
+	Live           int64
+	Success        int64
+	Failure        int64
+	Timeout        int64
+	ConnectLatency *PrometheusHistogram
+	DNSLatency     *PrometheusHistogram
+	DialLatency    *PrometheusHistogram
+}
+
+//PrometheusExporter serves the metrics of the test on /metrics in the Prometheus text format
+type PrometheusExporter struct {
+	Prefix   string
+	Series   map[PrometheusLabels]*PrometheusSeries
+	Listener net.Listener
+	Server   *http.Server
+	lock     sync.Mutex
+}
+
+//NewPrometheusExporter makes the exporter & listens on the host & port, panics if the port can not be listened on
+func NewPrometheusExporter(host string, port int, prefix string) *PrometheusExporter {
+
+	if port <= 0 {
+		panic(fmt.Sprintf("Invalid port for prometheus reporter: %v", port))
+	}
+
+	if prefix == "" {
+		prefix = "kratos"
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		panic(fmt.Sprintf("Error listening for prometheus reporter: %v", err))
+	}
+
+	exporter := &PrometheusExporter{
+		Prefix:   PrometheusName(prefix),
+		Series:   make(map[PrometheusLabels]*PrometheusSeries),
+		Listener: listener,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	exporter.Server = &http.Server{Handler: mux}
+
+	return exporter
+}
+
+//Start serves the metrics until the exporter is closed
+func (p *PrometheusExporter) Start() {
+
+	err := p.Server.Serve(p.Listener)
+	if err != nil && err != http.ErrServerClosed {
+		fmt.Println("Error serving prometheus metrics", err)
+	}
+}
+
+//Close stops serving the metrics
+func (p *PrometheusExporter) Close() {
+	p.Server.Close()
+}
+
+//Connected counts the outcome of the connect as it happens, connected sockets are live till they are done
+func (p *PrometheusExporter) Connected(event *models.ConnectEvent) {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	series := p.GetSeries(event.HitrateIndex, event.Scenario)
+
+	if event.Success {
+		series.Success++
+		series.Live++
+	} else if event.Timeout {
+		series.Timeout++
+	} else {
+		series.Failure++
+	}
+}
+
+//Observe adds the latencies of a socket done with its tests to the histograms
+func (p *PrometheusExporter) Observe(metric *models.SocketStats) {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	series := p.GetSeries(metric.HitrateIndex, metric.Scenario)
+
+	//Only connected sockets were counted as live
+	if metric.Success {
+		series.Live--
+	}
+
+	series.ConnectLatency.Observe(metric.ConnectTime)
+	series.DNSLatency.Observe(metric.DNSResolutionTime)
+	series.DialLatency.Observe(metric.OverallTime)
+}
+
+//GetSeries gets the series of the labels, making it on first use. Lock must be held
+func (p *PrometheusExporter) GetSeries(hitIdx int, scenario string) *PrometheusSeries {
+
+	labels := PrometheusLabels{Hitrate: hitIdx, Scenario: scenario}
+
+	series, ok := p.Series[labels]
+	if !ok {
+		series = &PrometheusSeries{
+			ConnectLatency: NewPrometheusHistogram(),
+			DNSLatency:     NewPrometheusHistogram(),
+			DialLatency:    NewPrometheusHistogram(),
+		}
+		p.Series[labels] = series
+	}
+
+	return series
+}
+
+//ServeHTTP writes all series in the Prometheus text exposition format
+func (p *PrometheusExporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	labels := make([]PrometheusLabels, 0, len(p.Series))
+	for label := range p.Series {
+		labels = append(labels, label)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Hitrate != labels[j].Hitrate {
+			return labels[i].Hitrate < labels[j].Hitrate
+		}
+		return labels[i].Scenario < labels[j].Scenario
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	name := p.Prefix + "_connections_total"
+	fmt.Fprintf(out, "# HELP %s Connects, by result.\n# TYPE %s counter\n", name, name)
+	for _, label := range labels {
+		series := p.Series[label]
+		fmt.Fprintf(out, "%s{%s,result=\"success\"} %v\n", name, label.String(), series.Success)
+		fmt.Fprintf(out, "%s{%s,result=\"failure\"} %v\n", name, label.String(), series.Failure)
+		fmt.Fprintf(out, "%s{%s,result=\"timeout\"} %v\n", name, label.String(), series.Timeout)
+	}
+
+	name = p.Prefix + "_live_connections"
+	fmt.Fprintf(out, "# HELP %s Connections connected & yet to be done.\n# TYPE %s gauge\n", name, name)
+	for _, label := range labels {
+		fmt.Fprintf(out, "%s{%s} %v\n", name, label.String(), p.Series[label].Live)
+	}
+
+	p.WriteHistogram(out, "connect_seconds", "Time taken to connect.", labels, func(series *PrometheusSeries) *PrometheusHistogram {
+		return series.ConnectLatency
+	})
+	p.WriteHistogram(out, "dns_seconds", "Time taken to resolve DNS.", labels, func(series *PrometheusSeries) *PrometheusHistogram {
+		return series.DNSLatency
+	})
+	p.WriteHistogram(out, "dial_seconds", "Time taken to dial the host, with DNS resolution & connect.", labels, func(series *PrometheusSeries) *PrometheusHistogram {
+		return series.DialLatency
+	})
+}
+
+//WriteHistogram writes the histogram of every series, with the buckets, sum & count
+func (p *PrometheusExporter) WriteHistogram(out *bufio.Writer, suffix string, help string, labels []PrometheusLabels, histogram func(*PrometheusSeries) *PrometheusHistogram) {
+
+	name := p.Prefix + "_" + suffix
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	for _, label := range labels {
+		hist := histogram(p.Series[label])
+
+		for idx, bound := range PrometheusBuckets {
+			fmt.Fprintf(out, "%s_bucket{%s,le=\"%s\"} %v\n", name, label.String(), strconv.FormatFloat(bound, 'f', -1, 64), hist.Buckets[idx])
+		}
+		fmt.Fprintf(out, "%s_bucket{%s,le=\"+Inf\"} %v\n", name, label.String(), hist.Count)
+		fmt.Fprintf(out, "%s_sum{%s} %v\n", name, label.String(), strconv.FormatFloat(hist.Sum, 'g', -1, 64))
+		fmt.Fprintf(out, "%s_count{%s} %v\n", name, label.String(), hist.Count)
+	}
+}
+
+//NewPrometheusHistogram makes an empty histogram with the default buckets
+func NewPrometheusHistogram() *PrometheusHistogram {
+	return &PrometheusHistogram{Buckets: make([]int64, len(PrometheusBuckets))}
+}
+
+//Observe adds the latency to all buckets it fits in
+func (h *PrometheusHistogram) Observe(latency time.Duration) {
+
+	seconds := latency.Seconds()
+
+	for idx, bound := range PrometheusBuckets {
+		if seconds <= bound {
+			h.Buckets[idx]++
+		}
+	}
+
+	h.Count++
+	h.Sum += seconds
+}
+
+//String formats the labels for the text format, like hitrate="0",scenario="default"
+func (l PrometheusLabels) String() string {
+	return fmt.Sprintf("hitrate=\"%d\",scenario=\"%s\"", l.Hitrate, PrometheusEscaper.Replace(l.Scenario))
+}
+
+//PrometheusEscaper escapes label values for the text format
+var PrometheusEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+//PrometheusName replaces characters not allowed in metric names with underscores, like "example.myapp" to "example_myapp"
+func PrometheusName(name string) string {
+
+	return strings.Map(func(char rune) rune {
+		if char == '_' || char == ':' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') {
+			return char
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,619 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//LatencyNames are the latencies of results, in the order they are reported
+var LatencyNames = []string{"connect", "dns", "overall", "tlsHandshake", "upgrade", "roundTrip", "ping", "close"}
+
+//ReportOptions are the options of the report command, read from args like --file=events.ndjson
+type ReportOptions struct {
+	File      string
+	From      time.Duration
+	To        time.Duration
+	HitRate   int
+	Scenario  string
+	Quantiles []float64
+	Format    string
+}
+
+//ReportUsage is printed along with errors of the report command
+const ReportUsage = "Usage: kratos report --file=<results.json|events.ndjson|events.csv> [--from=<duration>] [--to=<duration>] [--hitrate=<index>] [--scenario=<name>] [--quantiles=0.5,0.99] [--format=text|json|csv]"
+
+//ParseReportOptions parses the args of the report command
+func ParseReportOptions(args []string) (ReportOptions, error) {
+
+	options := ReportOptions{
+		HitRate: -1,
+		Format:  "text",
+	}
+
+	for _, arg := range args {
+		vals := strings.SplitN(arg, "=", 2)
+		if len(vals) < 2 {
+			return options, fmt.Errorf("invalid report option found: %s", arg)
+		}
+
+		switch vals[0] {
+		case "--file":
+			options.File = vals[1]
+		case "--from", "--to":
+			dur, err := models.ParseDuration(vals[1])
+			if err != nil {
+				return options, fmt.Errorf("invalid %s found: %s", vals[0], vals[1])
+			}
+			if vals[0] == "--from" {
+				options.From = time.Duration(dur)
+			} else {
+				options.To = time.Duration(dur)
+			}
+		case "--hitrate":
+			idx, err := strconv.Atoi(vals[1])
+			if err != nil || idx < 0 {
+				return options, fmt.Errorf("invalid hitrate index found: %s", vals[1])
+			}
+			options.HitRate = idx
+		case "--scenario":
+			options.Scenario = vals[1]
+		case "--quantiles":
+			for _, val := range strings.Split(vals[1], ",") {
+				quantile, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil || quantile <= 0 || quantile > 1 {
+					return options, fmt.Errorf("invalid quantile found: %s, quantiles are between 0 & 1", val)
+				}
+				options.Quantiles = append(options.Quantiles, quantile)
+			}
+		case "--format":
+			if vals[1] != "text" && vals[1] != "json" && vals[1] != "csv" {
+				return options, fmt.Errorf("invalid report format found: %s", vals[1])
+			}
+			options.Format = vals[1]
+		default:
+			return options, fmt.Errorf("invalid report option found: %s", arg)
+		}
+	}
+
+	if options.File == "" {
+		return options, errors.New("report needs a results file or an event log, like --file=events.ndjson")
+	}
+
+	if options.To > 0 && options.To <= options.From {
+		return options, errors.New("report needs --to to be after --from")
+	}
+
+	return options, nil
+}
+
+//RunReport reads a saved results file or event log, & prints its results in the format of the options.
+//Errors are printed with the usage, exiting with status 1
+func RunReport(args []string) {
+
+	if err := ReportFromArgs(args); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		fmt.Fprintln(os.Stderr, ReportUsage)
+		os.Exit(1)
+	}
+}
+
+//ReportFromArgs prints the results of the saved results file or event log of the args
+func ReportFromArgs(args []string) error {
+
+	options, err := ParseReportOptions(args)
+	if err != nil {
+		return err
+	}
+
+	//Text is reported with the same quantiles as a test, unless set
+	quantiles := options.Quantiles
+	if len(quantiles) == 0 && options.Format == "text" {
+		quantiles = DefaultReportQuantiles
+	} else if len(quantiles) == 0 {
+		quantiles = DefaultQuantiles
+	}
+
+	results, err := ReadResults(options.File)
+	if err != nil {
+		return err
+	}
+
+	if results != nil {
+		if err := FilterResults(results, options); err != nil {
+			return err
+		}
+
+		//Saved results only have the quantiles they were saved with
+		if len(options.Quantiles) == 0 {
+			quantiles = results.Quantiles
+		} else if err := CheckSavedQuantiles(results, options.Quantiles); err != nil {
+			return err
+		}
+	} else {
+		results, err = ResultsFromEvents(options, quantiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch options.Format {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "csv":
+		Reporter.ReportCSV(results, quantiles)
+	default:
+		Reporter.ReportText(results, quantiles)
+	}
+
+	return nil
+}
+
+//CheckSavedQuantiles checks if the quantiles are in the saved results, as they can't be recomputed without the event log
+func CheckSavedQuantiles(results *models.Results, quantiles []float64) error {
+
+	saved := make(map[string]bool)
+	names := make([]string, 0, len(results.Quantiles))
+	for _, quantile := range results.Quantiles {
+		saved[QuantileName(quantile)] = true
+		names = append(names, QuantileName(quantile))
+	}
+
+	for _, quantile := range quantiles {
+		if !saved[QuantileName(quantile)] {
+			return fmt.Errorf("quantile %v (%s) is not in the results file, it only has: %s", quantile, QuantileName(quantile), strings.Join(names, ", "))
+		}
+	}
+
+	return nil
+}
+
+//ReadResults reads a results file, returns nil results if the file is an event log
+func ReadResults(path string) (*models.Results, error) {
+
+	//CSV files are always event logs
+	if strings.HasSuffix(path, ".csv") {
+		return nil, nil
+	}
+
+	fileRef, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fileRef.Close()
+
+	//Results files are a single JSON object with a schema version, event logs are a JSON object per line
+	var first json.RawMessage
+	if err := json.NewDecoder(fileRef).Decode(&first); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	var version struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(first, &version); err != nil || version.SchemaVersion == 0 {
+		return nil, nil
+	}
+
+	if version.SchemaVersion > models.ResultsSchemaVersion {
+		return nil, fmt.Errorf("results file has schema version %v, only versions up to %v can be read", version.SchemaVersion, models.ResultsSchemaVersion)
+	}
+
+	results := &models.Results{}
+	if err := json.Unmarshal(first, results); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	return results, nil
+}
+
+//FilterResults filters saved results by hitrate or scenario. Results files only have totals, so time windows need an event log
+func FilterResults(results *models.Results, options ReportOptions) error {
+
+	if options.From > 0 || options.To > 0 {
+		return errors.New("time windows need an event log, results files only have totals")
+	}
+
+	if options.HitRate >= 0 {
+		found := false
+		for _, hitrate := range results.HitRates {
+			if hitrate.Index == options.HitRate {
+				results.All = hitrate.Stats
+				results.HitRates = []models.HitRateResult{hitrate}
+				results.Scenarios = nil
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("hitrate %v not found in results", options.HitRate)
+		}
+	}
+
+	if options.Scenario != "" {
+		found := false
+		for _, scenario := range results.Scenarios {
+			if scenario.Name == options.Scenario {
+				results.All = scenario.Stats
+				results.HitRates = nil
+				results.Scenarios = []models.ScenarioResult{scenario}
+				found = true
+				break
+			}
+		}
+
+		//Results per scenario are not split per hitrate
+		if !found {
+			return fmt.Errorf("scenario %s not found in results, results of a scenario can't be filtered by hitrate", options.Scenario)
+		}
+	}
+
+	return nil
+}
+
+//ResultsFromEvents rebuilds the results from an event log, with the filters & quantiles of the options
+func ResultsFromEvents(options ReportOptions, quantiles []float64) (*models.Results, error) {
+
+	//Time windows start when the first connection is opened
+	var runStart time.Time
+	if options.From > 0 || options.To > 0 {
+		err := ReadEvents(options.File, func(metric *models.SocketStats) {
+			if runStart.IsZero() || metric.Timestamp.Before(runStart) {
+				runStart = metric.Timestamp
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reporter := &StatsReporter{
+		RateStats:     make(map[int]*models.HitRateStats),
+		AllStats:      NewHitRateStats(),
+		ScenarioStats: make(map[string]*models.HitRateStats),
+	}
+
+	//Rates are over the time connections were opened in
+	firsts := make(map[*models.HitRateStats]time.Time)
+	lasts := make(map[*models.HitRateStats]time.Time)
+
+	err := ReadEvents(options.File, func(metric *models.SocketStats) {
+
+		if options.HitRate >= 0 && metric.HitrateIndex != options.HitRate {
+			return
+		}
+
+		if options.Scenario != "" && metric.Scenario != options.Scenario {
+			return
+		}
+
+		if !runStart.IsZero() {
+			offset := metric.Timestamp.Sub(runStart)
+			if offset < options.From || (options.To > 0 && offset >= options.To) {
+				return
+			}
+		}
+
+		hrStat, ok := reporter.RateStats[metric.HitrateIndex]
+		if !ok {
+			hrStat = NewHitRateStats()
+			reporter.RateStats[metric.HitrateIndex] = hrStat
+		}
+
+		if _, ok := reporter.ScenarioStats[metric.Scenario]; !ok {
+			reporter.MakeScenarioStat(&models.Scenario{Name: metric.Scenario})
+		}
+
+		reporter.MeasureLatencies(hrStat, metric)
+
+		for _, stat := range []*models.HitRateStats{hrStat, reporter.AllStats, reporter.ScenarioStats[metric.Scenario]} {
+			if first, ok := firsts[stat]; !ok || metric.Timestamp.Before(first) {
+				firsts[stat] = metric.Timestamp
+			}
+			if metric.Timestamp.After(lasts[stat]) {
+				lasts[stat] = metric.Timestamp
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for stat, first := range firsts {
+		stat.TotalDuration = lasts[stat].Sub(first)
+	}
+
+	results := &models.Results{
+		SchemaVersion: models.ResultsSchemaVersion,
+		Run: models.RunInfo{
+			StartTime:       firsts[reporter.AllStats],
+			EndTime:         lasts[reporter.AllStats],
+			DurationSeconds: reporter.AllStats.TotalDuration.Seconds(),
+		},
+		Quantiles: quantiles,
+		HitRates:  make([]models.HitRateResult, 0, len(reporter.RateStats)),
+		Scenarios: make([]models.ScenarioResult, 0, len(reporter.Scenarios)),
+		All:       reporter.MakeResultStats(reporter.AllStats, quantiles),
+	}
+
+	indexes := make([]int, 0, len(reporter.RateStats))
+	for idx := range reporter.RateStats {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	for _, idx := range indexes {
+		results.HitRates = append(results.HitRates, models.HitRateResult{
+			Index: idx,
+			Stats: reporter.MakeResultStats(reporter.RateStats[idx], quantiles),
+		})
+	}
+
+	for _, scenario := range reporter.Scenarios {
+		results.Scenarios = append(results.Scenarios, models.ScenarioResult{
+			Name:  scenario.Name,
+			Stats: reporter.MakeResultStats(reporter.ScenarioStats[scenario.Name], quantiles),
+		})
+	}
+
+	return results, nil
+}
+
+//ReadEvents reads every metric of an event log, NDJSON or CSV by the extension of the file
+func ReadEvents(path string, handle func(metric *models.SocketStats)) error {
+
+	fileRef, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fileRef.Close()
+
+	reader := bufio.NewReaderSize(fileRef, EventBufferSize)
+
+	if !strings.HasSuffix(path, ".csv") {
+		decoder := json.NewDecoder(reader)
+		for {
+			metric := &models.SocketStats{}
+			if err := decoder.Decode(metric); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("reading %s: %v", path, err)
+			}
+			handle(metric)
+		}
+	}
+
+	csvReader := csv.NewReader(reader)
+	header, err := csvReader.Read()
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	columns := make(map[string]int)
+	for idx, name := range header {
+		columns[name] = idx
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+
+		metric, err := ParseEventRecord(columns, record)
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+		handle(metric)
+	}
+}
+
+//ParseEventRecord makes the metric of a CSV record, with the index of every column by name
+func ParseEventRecord(columns map[string]int, record []string) (*models.SocketStats, error) {
+
+	var parseErr error
+	value := func(name string) string {
+		if idx, ok := columns[name]; ok && idx < len(record) {
+			return record[idx]
+		}
+		return ""
+	}
+	integer := func(name string) int64 {
+		val := value(name)
+		if val == "" {
+			return 0
+		}
+		num, err := strconv.ParseInt(val, 10, 64)
+		if err != nil && parseErr == nil {
+			parseErr = fmt.Errorf("invalid %s in event: %s", name, val)
+		}
+		return num
+	}
+	boolean := func(name string) bool {
+		return value(name) == "true"
+	}
+	durations := func(name string) []time.Duration {
+		val := value(name)
+		if val == "" {
+			return nil
+		}
+		vals := strings.Split(val, ";")
+		durs := make([]time.Duration, len(vals))
+		for idx, dur := range vals {
+			num, err := strconv.ParseInt(dur, 10, 64)
+			if err != nil && parseErr == nil {
+				parseErr = fmt.Errorf("invalid %s in event: %s", name, val)
+			}
+			durs[idx] = time.Duration(num)
+		}
+		return durs
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, value("timestamp"))
+	if err != nil {
+		return nil, err
+	}
+
+	metric := &models.SocketStats{
+		ConnectionID:      int(integer("id")),
+		Timestamp:         timestamp,
+		HitrateIndex:      int(integer("hrIdx")),
+		Scenario:          value("scenario"),
+		ConnectTime:       time.Duration(integer("connecttime")),
+		DNSResolutionTime: time.Duration(integer("dnstime")),
+		OverallTime:       time.Duration(integer("overalltime")),
+		TLSHandshakeTime:  time.Duration(integer("tlstime")),
+		UpgradeTime:       time.Duration(integer("upgradetime")),
+		Success:           boolean("success"),
+		Timeout:           boolean("timeout"),
+		StatusCode:        int(integer("statuscode")),
+		ErrorString:       value("error"),
+		ExpectMatch:       int(integer("expectmatch")),
+		ExpectMismatch:    int(integer("expectmismatch")),
+		ExpectTimeout:     int(integer("expecttimeout")),
+		ExtractSuccess:    int(integer("extractsuccess")),
+		ExtractFailure:    int(integer("extractfailure")),
+		RoundTripTimes:    durations("roundtriptimes"),
+		PingTimes:         durations("pingtimes"),
+		PingTimeouts:      int(integer("pingtimeouts")),
+		CloseTime:         time.Duration(integer("closetime")),
+		CloseTimeout:      boolean("closetimeout"),
+		ServerCloseCode:   int(integer("serverclosecode")),
+		Iterations:        int(integer("iterations")),
+		Held:              boolean("held"),
+		HoldDropped:       boolean("holddropped"),
+		MessagesSent:      integer("msgssent"),
+		BytesSent:         integer("bytessent"),
+		SendFailures:      integer("sendfailures"),
+		MessagesReceived:  integer("msgsreceived"),
+		BytesReceived:     integer("bytesreceived"),
+		ReadErrors:        integer("readerrors"),
+		Compressed:        boolean("compressed"),
+		WireBytesSent:     integer("wirebytessent"),
+		WireBytesReceived: integer("wirebytesreceived"),
+	}
+
+	return metric, parseErr
+}
+
+//ReportText prints the results like the report of a test, per hitrate, all & per scenario
+func (r *StatsReporter) ReportText(results *models.Results, quantiles []float64) {
+
+	for _, hitrate := range results.HitRates {
+		fmt.Fprintf(r.TabWriter, "Hitrate Results\tindex=%v\n", hitrate.Index)
+		r.ReportResult(hitrate.Stats, quantiles)
+	}
+
+	if results.Run.Stopped {
+		fmt.Fprintln(r.TabWriter, "Tests Stopped\tPartial Results Below:")
+		if results.Run.StopReason != "" {
+			fmt.Fprintf(r.TabWriter, "Stop Condition\t%s\n", results.Run.StopReason)
+		}
+	} else {
+		fmt.Fprintln(r.TabWriter, "All Results\tResults Below:")
+	}
+	r.ReportResult(results.All, quantiles)
+
+	//Like a test, a single scenario is all results
+	if len(results.Scenarios) < 2 {
+		return
+	}
+
+	for _, scenario := range results.Scenarios {
+		fmt.Fprintf(r.TabWriter, "Scenario Results\tname=%s\n", scenario.Name)
+		r.ReportResult(scenario.Stats, quantiles)
+	}
+}
+
+//ReportCSV prints the results as CSV, with a row per hitrate, all & per scenario
+func (r *StatsReporter) ReportCSV(results *models.Results, quantiles []float64) {
+
+	writer := csv.NewWriter(os.Stdout)
+
+	header := []string{
+		"section", "name", "durationSeconds",
+		"connections.total", "connections.success", "connections.failure", "connections.timeout", "connections.compressed",
+		"expect.match", "expect.mismatch", "expect.timeout", "extract.success", "extract.failure",
+		"messages.sent", "messages.bytesSent", "messages.sendFailures", "messages.received", "messages.bytesReceived", "messages.readErrors",
+		"messages.wireBytesSent", "messages.wireBytesReceived",
+		"iterations", "hold.held", "hold.dropped", "pingTimeouts", "closeTimeouts", "errors",
+	}
+	for _, name := range LatencyNames {
+		header = append(header, name+".count", name+".min")
+		for _, quantile := range quantiles {
+			header = append(header, name+"."+QuantileName(quantile))
+		}
+		header = append(header, name+".max")
+	}
+	writer.Write(header)
+
+	for _, hitrate := range results.HitRates {
+		writer.Write(ResultRecord("hitrate", strconv.Itoa(hitrate.Index), hitrate.Stats, quantiles))
+	}
+
+	writer.Write(ResultRecord("all", "", results.All, quantiles))
+
+	for _, scenario := range results.Scenarios {
+		writer.Write(ResultRecord("scenario", scenario.Name, scenario.Stats, quantiles))
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		fmt.Println("Reporting error", err)
+	}
+}
+
+//ResultRecord makes the CSV record of stats, quantiles never measured are left empty
+func ResultRecord(section string, name string, stats models.ResultStats, quantiles []float64) []string {
+
+	errors := 0
+	for _, count := range stats.Errors {
+		errors += count
+	}
+
+	record := []string{
+		section, name, strconv.FormatFloat(stats.DurationSeconds, 'f', -1, 64),
+		strconv.Itoa(stats.Connections.Total), strconv.Itoa(stats.Connections.Success), strconv.Itoa(stats.Connections.Failure),
+		strconv.Itoa(stats.Connections.Timeout), strconv.Itoa(stats.Connections.Compressed),
+		strconv.Itoa(stats.Expect.Match), strconv.Itoa(stats.Expect.Mismatch), strconv.Itoa(stats.Expect.Timeout),
+		strconv.Itoa(stats.Extract.Success), strconv.Itoa(stats.Extract.Failure),
+		strconv.FormatInt(stats.Messages.Sent, 10), strconv.FormatInt(stats.Messages.BytesSent, 10), strconv.FormatInt(stats.Messages.SendFailures, 10),
+		strconv.FormatInt(stats.Messages.Received, 10), strconv.FormatInt(stats.Messages.BytesReceived, 10), strconv.FormatInt(stats.Messages.ReadErrors, 10),
+		strconv.FormatInt(stats.Messages.WireBytesSent, 10), strconv.FormatInt(stats.Messages.WireBytesReceived, 10),
+		strconv.Itoa(stats.Iterations), strconv.Itoa(stats.Hold.Held), strconv.Itoa(stats.Hold.Dropped),
+		strconv.Itoa(stats.PingTimeouts), strconv.Itoa(stats.CloseTimeouts), strconv.Itoa(errors),
+	}
+
+	for _, name := range LatencyNames {
+		latency := stats.Latencies[name]
+		record = append(record, strconv.Itoa(latency.Count), strconv.FormatFloat(latency.Min, 'f', -1, 64))
+		for _, quantile := range quantiles {
+			value, ok := latency.Quantiles[QuantileName(quantile)]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		record = append(record, strconv.FormatFloat(latency.Max, 'f', -1, 64))
+	}
+
+	return record
+}
@@ -2,7 +2,10 @@ package service
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -17,65 +20,78 @@ import (
 
 //StatsReporter is the struct that holds all test stats
 type StatsReporter struct {
-	RateStats     map[int]*models.HitRateStats
-	AllStats      *models.HitRateStats
-	ReportChan    chan *models.SocketStats
-	TestDoneChan  chan bool
-	ReportString  string
-	HitrateString string
-	TabWriter     *tabwriter.Writer
-	StatsdClient  *statsd.StatsdClient
-	StatsStrings  struct {
+	RateStats      map[int]*models.HitRateStats
+	AllStats       *models.HitRateStats
+	ScenarioStats  map[string]*models.HitRateStats
+	Scenarios      []*models.Scenario
+	StopChecks     []*StopCheck
+	StopReason     string
+	Quantiles      []float64
+	EventLog       *EventLog
+	Timeline       []*TimeBucket
+	ReportChan     chan *models.SocketStats
+	ConnectChan    chan *models.ConnectEvent
+	TestDoneChan   chan bool
+	RowString      string
+	HitrateString  string
+	StageString    string
+	ScenarioString string
+	StartTime      time.Time
+	TabWriter      *tabwriter.Writer
+	StatsdClient   *statsd.StatsdClient
+	Prometheus     *PrometheusExporter
+	StatsStrings   struct {
 		Success        string
 		Failure        string
+		Timeout        string
 		ConnectLatency string
 		DNSLatency     string
 		OverallLatency string
+		TLSLatency     string
+		UpgradeLatency string
+		RoundTrip      string
+		PingLatency    string
+		PingTimeout    string
+		CloseLatency   string
+		CloseTimeout   string
+		MessagesSent   string
+		BytesSent      string
+		SendFailures   string
 	}
 }
 
+//DefaultReportQuantiles are the quantiles of latencies printed in reports
+var DefaultReportQuantiles = []float64{0.5, 0.95, 0.99}
+
 //Reporter singleton object
 var Reporter StatsReporter
 
 func init() {
 	Reporter = StatsReporter{
-		RateStats:    make(map[int]*models.HitRateStats),
-		ReportChan:   make(chan *models.SocketStats),
-		TestDoneChan: make(chan bool),
-		AllStats: &models.HitRateStats{
-			TotalConnections:        0,
-			ConnectSuccess:          0.0,
-			ConnectFailure:          0.0,
-			ConnectTimeout:          0.0,
-			ConnectLatencies:        tdigest.NewWithCompression(100),
-			DNSResolutionLatencies:  tdigest.NewWithCompression(100),
-			OverallLatencies:        tdigest.NewWithCompression(100),
-			ConnectLatencyMin:       0,
-			ConnectLatencyMax:       0,
-			DNSResolutionLatencyMin: 0,
-			DNSResolutionLatencyMax: 0,
-			OverallLatencyMin:       0,
-			OverallLatencyMax:       0,
-			ErrorSet:                make(map[string]int),
-		},
-	}
-
-	Reporter.ReportString = "Connections\t[total]\t%v sockets\n" +
-		"Connect\t[success, error, timeout]\t%v, %v, %v\n" +
-		"Connect Time\t[min, p50, p95, p99, max]\t%s, %s, %s, %s, %s\n" +
-		"DNS Time\t[min, p50, p95, p99, max]\t%s, %s, %s, %s, %s\n" +
-		"Overall Time\t[min, p50, p95, p99, max]\t%s, %s, %s, %s, %s\n"
+		RateStats:     make(map[int]*models.HitRateStats),
+		ReportChan:    make(chan *models.SocketStats),
+		ConnectChan:   make(chan *models.ConnectEvent),
+		TestDoneChan:  make(chan bool),
+		AllStats:      NewHitRateStats(),
+		Quantiles:     DefaultReportQuantiles,
+		ScenarioStats: make(map[string]*models.HitRateStats),
+	}
+
+	//Rows are the name, labels & values of a stat
+	Reporter.RowString = "%s\t[%s]\t%s\n"
+
+	Reporter.ScenarioString = "Scenario Results\tname=%s, weight=%v\n"
 
 	Reporter.HitrateString = "Hitrate Connection Parameters\tstart=%v, end=%v, total=%v, duration=%vs\n"
+	Reporter.StageString = "Concurrency Stage Parameters\tstart=%v, end=%v, total=%v, duration=%vs\n"
 
 	Reporter.TabWriter = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.StripEscape)
 }
 
-//MakeHitRateStat makes a stat object based on the hitrate id
-func (r *StatsReporter) MakeHitRateStat(idx int, hitrate models.HitRate) {
+//NewHitRateStats makes an empty stat object
+func NewHitRateStats() *models.HitRateStats {
 
-	hrStat := models.HitRateStats{
-		HitRateRef:              &hitrate,
+	return &models.HitRateStats{
 		TotalConnections:        0,
 		ConnectSuccess:          0.0,
 		ConnectFailure:          0.0,
@@ -83,6 +99,11 @@ func (r *StatsReporter) MakeHitRateStat(idx int, hitrate models.HitRate) {
 		ConnectLatencies:        tdigest.NewWithCompression(100),
 		DNSResolutionLatencies:  tdigest.NewWithCompression(100),
 		OverallLatencies:        tdigest.NewWithCompression(100),
+		TLSHandshakeLatencies:   tdigest.NewWithCompression(100),
+		UpgradeLatencies:        tdigest.NewWithCompression(100),
+		RoundTripLatencies:      tdigest.NewWithCompression(100),
+		PingLatencies:           tdigest.NewWithCompression(100),
+		CloseLatencies:          tdigest.NewWithCompression(100),
 		ConnectLatencyMin:       0,
 		ConnectLatencyMax:       0,
 		DNSResolutionLatencyMin: 0,
@@ -90,12 +111,32 @@ func (r *StatsReporter) MakeHitRateStat(idx int, hitrate models.HitRate) {
 		OverallLatencyMin:       0,
 		OverallLatencyMax:       0,
 		ErrorSet:                make(map[string]int),
+		StatusCodes:             make(map[int]int),
+		CloseCodes:              make(map[int]int),
 	}
+}
+
+//MakeHitRateStat makes a stat object based on the hitrate id
+func (r *StatsReporter) MakeHitRateStat(idx int, hitrate models.HitRate) {
 
-	r.RateStats[idx] = &hrStat
+	hrStat := NewHitRateStats()
+	hrStat.HitRateRef = &hitrate
+	hrStat.TotalDuration = time.Duration(hitrate.Duration) * time.Second
+
+	r.RateStats[idx] = hrStat
+}
+
+//MakeScenarioStat makes a stat object for the scenario
+func (r *StatsReporter) MakeScenarioStat(scenario *models.Scenario) {
+
+	scenarioStat := NewHitRateStats()
+	scenarioStat.ScenarioRef = scenario
+
+	r.ScenarioStats[scenario.Name] = scenarioStat
+	r.Scenarios = append(r.Scenarios, scenario)
 }
 
-//ConnectDameon connect reporter module to connect to any third party reporting tool like a statsd daemon
+//ConnectDameon connect reporter module to connect to any third party reporting tool like a statsd daemon, or serves metrics for prometheus
 func (r *StatsReporter) ConnectDameon() {
 
 	if config.Config.Reporter.Type == "statsd" {
@@ -105,15 +146,33 @@ func (r *StatsReporter) ConnectDameon() {
 
 		Reporter.StatsStrings.Success = fmt.Sprintf("%s.socket.success", config.Config.Reporter.Prefix)
 		Reporter.StatsStrings.Failure = fmt.Sprintf("%s.socket.failure", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.Timeout = fmt.Sprintf("%s.socket.timeout", config.Config.Reporter.Prefix)
 		Reporter.StatsStrings.ConnectLatency = fmt.Sprintf("%s.socket.connect-latency", config.Config.Reporter.Prefix)
 		Reporter.StatsStrings.DNSLatency = fmt.Sprintf("%s.socket.dns-resolution-latency", config.Config.Reporter.Prefix)
 		Reporter.StatsStrings.OverallLatency = fmt.Sprintf("%s.socket.overall-latency", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.TLSLatency = fmt.Sprintf("%s.socket.tls-handshake-latency", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.UpgradeLatency = fmt.Sprintf("%s.socket.upgrade-latency", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.RoundTrip = fmt.Sprintf("%s.message.roundtrip-latency", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.PingLatency = fmt.Sprintf("%s.socket.ping-latency", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.PingTimeout = fmt.Sprintf("%s.socket.ping-timeout", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.CloseLatency = fmt.Sprintf("%s.socket.close-latency", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.CloseTimeout = fmt.Sprintf("%s.socket.close-timeout", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.MessagesSent = fmt.Sprintf("%s.message.sent", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.BytesSent = fmt.Sprintf("%s.message.bytes-sent", config.Config.Reporter.Prefix)
+		Reporter.StatsStrings.SendFailures = fmt.Sprintf("%s.message.send-failure", config.Config.Reporter.Prefix)
+	} else if config.Config.Reporter.Type == "prometheus" {
+
+		//Serve metrics for prometheus to scrape during the test
+		Reporter.Prometheus = NewPrometheusExporter(config.Config.Reporter.Host, config.Config.Reporter.Port, config.Config.Reporter.Prefix)
+		go Reporter.Prometheus.Start()
 	}
 }
 
 //Start starts the reporter to listen to any metric data coming on channel
 func (r *StatsReporter) Start() {
 
+	r.StartTime = time.Now()
+
 	for {
 		select {
 		case metric := <-r.ReportChan:
@@ -123,37 +182,134 @@ func (r *StatsReporter) Start() {
 
 			r.MeasureLatencies(hrStat, metric)
 
+			if r.EventLog != nil {
+				r.EventLog.Log(metric)
+			}
+
+			//Charts of the HTML report are per second of the test
+			if config.Config.Output.HTML != "" {
+				r.AddToTimeline(metric)
+			}
+
 			if config.Config.Reporter.Type == "statsd" {
 				r.ReportStatsd(metric)
+			} else if r.Prometheus != nil {
+				r.Prometheus.Observe(metric)
 			}
 
 			if hrStat.TotalConnections >= hrStat.HitRateRef.Connections {
 				//Report this hit rate as all connections for this hitrate have finished
 				r.LogHitrate(hrStat.HitRateRef)
 				r.Report(hrStat)
+				hrStat.Reported = true
+			}
+
+		case event := <-r.ConnectChan:
+			if r.Prometheus != nil {
+				r.Prometheus.Connected(event)
+			}
+
+			//Stop the test early once a stop condition is met
+			if r.StopReason == "" && !TestRunner.Stopped() {
+				r.CheckStopConditions(event)
 			}
 
 		case <-r.TestDoneChan:
+			//Report hitrates not reported yet, like concurrency stages whose connections are only known at the end
+			for idx := 0; idx < len(r.RateStats); idx++ {
+				hrStat := r.RateStats[idx]
+
+				//Hitrates never started when the test is stopped have nothing to report
+				if hrStat.Reported || hrStat.TotalConnections == 0 {
+					continue
+				}
+
+				hrStat.HitRateRef.Connections = hrStat.TotalConnections
+				r.LogHitrate(hrStat.HitRateRef)
+				r.Report(hrStat)
+				hrStat.Reported = true
+			}
+
 			//Test done
-			fmt.Fprintln(r.TabWriter, "All Tests Complete\tFinal Results Below:")
+			if TestRunner.Stopped() {
+				fmt.Fprintln(r.TabWriter, "Tests Stopped\tPartial Results Below:")
+				if r.StopReason != "" {
+					fmt.Fprintf(r.TabWriter, "Stop Condition\t%s\n", r.StopReason)
+				}
+			} else {
+				fmt.Fprintln(r.TabWriter, "All Tests Complete\tFinal Results Below:")
+			}
+			r.AllStats.TotalDuration = time.Since(r.StartTime)
 
 			//Report all stats from all hitratestats
 			r.Report(r.AllStats)
 
+			//Break the results down per scenario, when there are many
+			if len(r.Scenarios) > 1 {
+				for _, scenario := range r.Scenarios {
+					scenarioStat := r.ScenarioStats[scenario.Name]
+					scenarioStat.TotalDuration = r.AllStats.TotalDuration
+
+					r.LogScenario(scenario)
+					r.Report(scenarioStat)
+				}
+			}
+
 			//Flush the tabwriter
 			r.TabWriter.Flush()
 
-			//Program can exit after above reporting
+			//Write the results for machines to read as well
+			if config.Config.Output.JSON != "" {
+				r.WriteResults(config.Config.Output.JSON)
+			}
+
+			if config.Config.Output.HTML != "" {
+				r.WriteHTML(config.Config.Output.HTML)
+			}
+
+			//Metrics coming in after the report are not logged
+			if r.EventLog != nil {
+				r.EventLog.Close()
+				r.EventLog = nil
+			}
+
+			//Metrics are only served for the duration of the test
+			if r.Prometheus != nil {
+				r.Prometheus.Close()
+			}
+
+			//Program can exit after above reporting, once idle sockets are closed on a stop
+			if TestRunner.Stopped() {
+				<-TestRunner.IdleClosedChan
+			}
 			TestRunner.TestDoneChan <- true
 		}
 	}
 }
 
+//CheckStopConditions checks every stop condition with the connect event & stops the test on the first one met
+func (r *StatsReporter) CheckStopConditions(event *models.ConnectEvent) {
+
+	for _, check := range r.StopChecks {
+		reason := check.Check(event)
+		if reason == "" {
+			continue
+		}
+
+		r.StopReason = reason
+		fmt.Printf("Stop condition met, %s. Stopping tests, closing connections within %v\n", reason, TestRunner.GracePeriod)
+		TestRunner.Stop()
+		return
+	}
+}
+
 //ReportStatsd reporting latencies out to statsd
 func (r *StatsReporter) ReportStatsd(metric *models.SocketStats) {
 
 	if metric.Success {
 		r.StatsdClient.Increment(Reporter.StatsStrings.Success)
+	} else if metric.Timeout {
+		r.StatsdClient.Increment(Reporter.StatsStrings.Timeout)
 	} else {
 		r.StatsdClient.Increment(Reporter.StatsStrings.Failure)
 	}
@@ -161,50 +317,153 @@ func (r *StatsReporter) ReportStatsd(metric *models.SocketStats) {
 	r.StatsdClient.Timing(Reporter.StatsStrings.ConnectLatency, metric.ConnectTime.Milliseconds())
 	r.StatsdClient.Timing(Reporter.StatsStrings.DNSLatency, metric.DNSResolutionTime.Milliseconds())
 	r.StatsdClient.Timing(Reporter.StatsStrings.OverallLatency, metric.OverallTime.Milliseconds())
+
+	//TLS handshake only happens for wss:// & the upgrade only when the handshake completes
+	if metric.TLSHandshakeTime > 0 {
+		r.StatsdClient.Timing(Reporter.StatsStrings.TLSLatency, metric.TLSHandshakeTime.Milliseconds())
+	}
+
+	if metric.UpgradeTime > 0 {
+		r.StatsdClient.Timing(Reporter.StatsStrings.UpgradeLatency, metric.UpgradeTime.Milliseconds())
+	}
+
+	if metric.MessagesSent > 0 {
+		r.StatsdClient.IncrementByValue(Reporter.StatsStrings.MessagesSent, int(metric.MessagesSent))
+		r.StatsdClient.IncrementByValue(Reporter.StatsStrings.BytesSent, int(metric.BytesSent))
+	}
+
+	if metric.SendFailures > 0 {
+		r.StatsdClient.IncrementByValue(Reporter.StatsStrings.SendFailures, int(metric.SendFailures))
+	}
+
+	for _, rtt := range metric.RoundTripTimes {
+		r.StatsdClient.Timing(Reporter.StatsStrings.RoundTrip, rtt.Milliseconds())
+	}
+
+	for _, ping := range metric.PingTimes {
+		r.StatsdClient.Timing(Reporter.StatsStrings.PingLatency, ping.Milliseconds())
+	}
+
+	if metric.PingTimeouts > 0 {
+		r.StatsdClient.IncrementByValue(Reporter.StatsStrings.PingTimeout, metric.PingTimeouts)
+	}
+
+	if metric.CloseTime > 0 {
+		r.StatsdClient.Timing(Reporter.StatsStrings.CloseLatency, metric.CloseTime.Milliseconds())
+	}
+
+	if metric.CloseTimeout {
+		r.StatsdClient.Increment(Reporter.StatsStrings.CloseTimeout)
+	}
 }
 
-//MeasureLatencies measures latencies when a metric comes in
+//MeasureLatencies measures latencies when a metric comes in, for the hitrate, the scenario & all stats
 func (r *StatsReporter) MeasureLatencies(hrStat *models.HitRateStats, metric *models.SocketStats) {
 
-	hrStat.TotalConnections++
-	r.AllStats.TotalConnections++
+	r.AddMetric(hrStat, metric)
+	r.AddMetric(r.AllStats, metric)
+
+	if scenarioStat, ok := r.ScenarioStats[metric.Scenario]; ok {
+		r.AddMetric(scenarioStat, metric)
+	}
+}
+
+//AddMetric adds the metric of a socket to the stats
+func (r *StatsReporter) AddMetric(stat *models.HitRateStats, metric *models.SocketStats) {
+
+	stat.TotalConnections++
 	if metric.Success {
-		hrStat.ConnectSuccess++
-		r.AllStats.ConnectSuccess++
+		stat.ConnectSuccess++
+	} else if metric.Timeout {
+		stat.ConnectTimeout++
 	} else {
-		r.AllStats.ConnectFailure++
-		hrStat.ConnectFailure++
+		stat.ConnectFailure++
 	}
 
-	//Add to Current hit rate stats
-	hrStat.ConnectLatencyMin, hrStat.ConnectLatencyMax = r.GetMinMax(metric.ConnectTime, hrStat.ConnectLatencyMin, hrStat.ConnectLatencyMax)
-	hrStat.DNSResolutionLatencyMin, hrStat.DNSResolutionLatencyMax = r.GetMinMax(metric.DNSResolutionTime, hrStat.DNSResolutionLatencyMin, hrStat.DNSResolutionLatencyMax)
-	hrStat.OverallLatencyMin, hrStat.OverallLatencyMax = r.GetMinMax(metric.OverallTime, hrStat.OverallLatencyMin, hrStat.OverallLatencyMax)
+	//Handshakes rejected by the host with a status code
+	if metric.StatusCode != 0 {
+		stat.StatusCodes[metric.StatusCode]++
+	}
 
-	hrStat.ConnectLatencies.Add(float64(metric.ConnectTime), 1)
-	hrStat.DNSResolutionLatencies.Add(float64(metric.DNSResolutionTime), 1)
-	hrStat.OverallLatencies.Add(float64(metric.OverallTime), 1)
+	stat.ExpectMatch += metric.ExpectMatch
+	stat.ExpectMismatch += metric.ExpectMismatch
+	stat.ExpectTimeout += metric.ExpectTimeout
+	stat.ExtractSuccess += metric.ExtractSuccess
+	stat.ExtractFailure += metric.ExtractFailure
+	stat.MessagesSent += metric.MessagesSent
+	stat.BytesSent += metric.BytesSent
+	stat.SendFailures += metric.SendFailures
+	stat.MessagesReceived += metric.MessagesReceived
+	stat.BytesReceived += metric.BytesReceived
+	stat.ReadErrors += metric.ReadErrors
+	stat.WireBytesSent += metric.WireBytesSent
+	stat.WireBytesReceived += metric.WireBytesReceived
+	if metric.Compressed {
+		stat.CompressedConnections++
+	}
 
-	//Add to all stats as well
-	r.AllStats.ConnectLatencyMin, r.AllStats.ConnectLatencyMax = r.GetMinMax(metric.ConnectTime, r.AllStats.ConnectLatencyMin, r.AllStats.ConnectLatencyMax)
-	r.AllStats.DNSResolutionLatencyMin, r.AllStats.DNSResolutionLatencyMax = r.GetMinMax(metric.DNSResolutionTime, r.AllStats.DNSResolutionLatencyMin, r.AllStats.DNSResolutionLatencyMax)
-	r.AllStats.OverallLatencyMin, r.AllStats.OverallLatencyMax = r.GetMinMax(metric.OverallTime, r.AllStats.OverallLatencyMin, r.AllStats.OverallLatencyMax)
+	stat.ConnectLatencyMin, stat.ConnectLatencyMax = r.GetMinMax(metric.ConnectTime, stat.ConnectLatencyMin, stat.ConnectLatencyMax)
+	stat.DNSResolutionLatencyMin, stat.DNSResolutionLatencyMax = r.GetMinMax(metric.DNSResolutionTime, stat.DNSResolutionLatencyMin, stat.DNSResolutionLatencyMax)
+	stat.OverallLatencyMin, stat.OverallLatencyMax = r.GetMinMax(metric.OverallTime, stat.OverallLatencyMin, stat.OverallLatencyMax)
 
-	r.AllStats.ConnectLatencies.Add(float64(metric.ConnectTime), 1)
-	r.AllStats.DNSResolutionLatencies.Add(float64(metric.DNSResolutionTime), 1)
-	r.AllStats.OverallLatencies.Add(float64(metric.OverallTime), 1)
+	stat.ConnectLatencies.Add(float64(metric.ConnectTime), 1)
+	stat.DNSResolutionLatencies.Add(float64(metric.DNSResolutionTime), 1)
+	stat.OverallLatencies.Add(float64(metric.OverallTime), 1)
 
-	if metric.ErrorString != "" {
-		if _, ok := hrStat.ErrorSet[metric.ErrorString]; ok {
-			hrStat.ErrorSet[metric.ErrorString]++
-		} else {
-			hrStat.ErrorSet[metric.ErrorString] = 1
-		}
+	if metric.TLSHandshakeTime > 0 {
+		stat.TLSHandshakeLatencyMin, stat.TLSHandshakeLatencyMax = r.GetMinMax(metric.TLSHandshakeTime, stat.TLSHandshakeLatencyMin, stat.TLSHandshakeLatencyMax)
+		stat.TLSHandshakeLatencies.Add(float64(metric.TLSHandshakeTime), 1)
+	}
 
-		if _, ok := r.AllStats.ErrorSet[metric.ErrorString]; ok {
-			r.AllStats.ErrorSet[metric.ErrorString]++
+	if metric.UpgradeTime > 0 {
+		stat.UpgradeLatencyMin, stat.UpgradeLatencyMax = r.GetMinMax(metric.UpgradeTime, stat.UpgradeLatencyMin, stat.UpgradeLatencyMax)
+		stat.UpgradeLatencies.Add(float64(metric.UpgradeTime), 1)
+	}
+
+	//Round trip times of messages with a paired response
+	for _, rtt := range metric.RoundTripTimes {
+		stat.RoundTripLatencyMin, stat.RoundTripLatencyMax = r.GetMinMax(rtt, stat.RoundTripLatencyMin, stat.RoundTripLatencyMax)
+		stat.RoundTripLatencies.Add(float64(rtt), 1)
+	}
+
+	//Round trip times of pings
+	for _, ping := range metric.PingTimes {
+		stat.PingLatencyMin, stat.PingLatencyMax = r.GetMinMax(ping, stat.PingLatencyMin, stat.PingLatencyMax)
+		stat.PingLatencies.Add(float64(ping), 1)
+	}
+
+	stat.Iterations += metric.Iterations
+
+	//Connections held till the end of the test
+	if metric.Held {
+		stat.Held++
+	}
+
+	if metric.HoldDropped {
+		stat.HoldDrops++
+	}
+	stat.PingTimeouts += metric.PingTimeouts
+
+	//Close handshakes started by the socket
+	if metric.CloseTime > 0 {
+		stat.CloseLatencyMin, stat.CloseLatencyMax = r.GetMinMax(metric.CloseTime, stat.CloseLatencyMin, stat.CloseLatencyMax)
+		stat.CloseLatencies.Add(float64(metric.CloseTime), 1)
+	}
+
+	if metric.CloseTimeout {
+		stat.CloseTimeouts++
+	}
+
+	//Connections closed by the host
+	if metric.ServerCloseCode != 0 {
+		stat.CloseCodes[metric.ServerCloseCode]++
+	}
+
+	if metric.ErrorString != "" {
+		if _, ok := stat.ErrorSet[metric.ErrorString]; ok {
+			stat.ErrorSet[metric.ErrorString]++
 		} else {
-			r.AllStats.ErrorSet[metric.ErrorString] = 1
+			stat.ErrorSet[metric.ErrorString] = 1
 		}
 	}
 }
@@ -223,30 +482,51 @@ func (r *StatsReporter) GetMinMax(val time.Duration, min float64, max float64) (
 	return min, max
 }
 
-func (r *StatsReporter) durationStr(dur float64) time.Duration {
-	return time.Duration(dur)
+//PerSecond gets the rate of a count over the duration
+func (r *StatsReporter) PerSecond(count float64, dur time.Duration) float64 {
+
+	if dur <= 0 {
+		return 0
+	}
+
+	return count / dur.Seconds()
+}
+
+//Ratio gets the ratio of uncompressed to wire bytes
+func (r *StatsReporter) Ratio(uncompressed int64, wire int64) float64 {
+
+	if wire <= 0 {
+		return 0
+	}
+
+	return float64(uncompressed) / float64(wire)
+}
+
+//durationStr gets the duration of milliseconds, as latencies are in milliseconds in results
+func (r *StatsReporter) durationStr(milliseconds float64) time.Duration {
+	return time.Duration(math.Round(milliseconds * float64(time.Millisecond)))
 }
 
 //Report prints out the stats as they currently stand
 func (r *StatsReporter) Report(hrStat *models.HitRateStats) {
+	r.ReportResult(r.MakeResultStats(hrStat, r.Quantiles), r.Quantiles)
+}
 
-	//Reporting stats from the tests
-	if _, err := fmt.Fprintf(r.TabWriter, r.ReportString,
-		hrStat.TotalConnections,
-		hrStat.ConnectSuccess, hrStat.ConnectFailure, hrStat.ConnectTimeout,
-		time.Duration(hrStat.ConnectLatencyMin), r.durationStr(hrStat.ConnectLatencies.Quantile(0.5)), r.durationStr(hrStat.ConnectLatencies.Quantile(0.95)), r.durationStr(hrStat.ConnectLatencies.Quantile(0.99)), time.Duration(hrStat.ConnectLatencyMax),
-		time.Duration(hrStat.DNSResolutionLatencyMin), r.durationStr(hrStat.DNSResolutionLatencies.Quantile(0.5)), r.durationStr(hrStat.DNSResolutionLatencies.Quantile(0.95)), r.durationStr(hrStat.DNSResolutionLatencies.Quantile(0.99)), time.Duration(hrStat.DNSResolutionLatencyMax),
-		time.Duration(hrStat.OverallLatencyMin), r.durationStr(hrStat.OverallLatencies.Quantile(0.5)), r.durationStr(hrStat.OverallLatencies.Quantile(0.95)), r.durationStr(hrStat.OverallLatencies.Quantile(0.99)), time.Duration(hrStat.OverallLatencyMax),
-	); err != nil {
-		fmt.Println("Reporting error", err)
+//ReportResult prints out the results of stats, live or saved, with the latencies at the quantiles
+func (r *StatsReporter) ReportResult(stats models.ResultStats, quantiles []float64) {
+
+	for _, row := range r.ReportRows(stats, quantiles) {
+		if _, err := fmt.Fprintf(r.TabWriter, r.RowString, row[0], row[1], row[2]); err != nil {
+			fmt.Println("Reporting error", err)
+		}
 	}
 
-	if len(hrStat.ErrorSet) == 0 {
+	if len(stats.Errors) == 0 {
 		if _, err := fmt.Fprintf(r.TabWriter, "Error Set\t[error, count]\tNo Errors\n\n"); err != nil {
 			fmt.Println("Reporting error", err)
 		}
 	} else {
-		for errStr, count := range hrStat.ErrorSet {
+		for errStr, count := range stats.Errors {
 			if _, err := fmt.Fprintf(r.TabWriter, "Error Set\t[error, count]\t%s, %v\n\n", errStr, count); err != nil {
 				fmt.Println("Reporting error", err)
 			}
@@ -257,10 +537,134 @@ func (r *StatsReporter) Report(hrStat *models.HitRateStats) {
 	r.TabWriter.Flush()
 }
 
+//ReportRows gets the rows of the report of stats, as the name, labels & values cells of each row, for stdout & the HTML report
+func (r *StatsReporter) ReportRows(stats models.ResultStats, quantiles []float64) [][]string {
+
+	duration := time.Duration(stats.DurationSeconds * float64(time.Second))
+
+	rows := [][]string{
+		{"Connections", "total", fmt.Sprintf("%v sockets", stats.Connections.Total)},
+		{"Connect", "success, error, timeout", fmt.Sprintf("%v, %v, %v", stats.Connections.Success, stats.Connections.Failure, stats.Connections.Timeout)},
+		{"Expect", "match, mismatch, timeout", fmt.Sprintf("%v, %v, %v", stats.Expect.Match, stats.Expect.Mismatch, stats.Expect.Timeout)},
+		{"Extract", "success, failure", fmt.Sprintf("%v, %v", stats.Extract.Success, stats.Extract.Failure)},
+		{"Sent", "messages, bytes, errors", fmt.Sprintf("%v, %v, %v", stats.Messages.Sent, stats.Messages.BytesSent, stats.Messages.SendFailures)},
+		{"Send Rate", "msg/s, MB/s", fmt.Sprintf("%.2f, %.2f", r.PerSecond(float64(stats.Messages.Sent), duration), r.PerSecond(float64(stats.Messages.BytesSent)/1e6, duration))},
+		{"Received", "messages, bytes, errors", fmt.Sprintf("%v, %v, %v", stats.Messages.Received, stats.Messages.BytesReceived, stats.Messages.ReadErrors)},
+		{"Receive Rate", "msg/s, MB/s", fmt.Sprintf("%.2f, %.2f", r.PerSecond(float64(stats.Messages.Received), duration), r.PerSecond(float64(stats.Messages.BytesReceived)/1e6, duration))},
+	}
+
+	//Only reported when repeat tests were run
+	if stats.Iterations > 0 {
+		rows = append(rows, []string{"Repeat", "iterations", fmt.Sprint(stats.Iterations)})
+	}
+
+	//Only reported when hold tests were run
+	if stats.Hold.Held > 0 {
+		rows = append(rows, []string{"Hold", "held, dropped", fmt.Sprintf("%v, %v", stats.Hold.Held, stats.Hold.Dropped)})
+	}
+
+	//Only reported when compression is enabled, or was negotiated for saved results
+	if config.Config.Config.Compression || stats.Connections.Compressed > 0 {
+		rows = append(rows, []string{"Compression", "negotiated, connected", fmt.Sprintf("%v, %v", stats.Connections.Compressed, stats.Connections.Success)})
+
+		//Wire bytes are not counted for wss:// hosts, as they would include TLS overhead
+		if stats.Messages.WireBytesSent > 0 || stats.Messages.WireBytesReceived > 0 {
+			rows = append(rows,
+				[]string{"Sent Bytes", "uncompressed, wire, ratio", fmt.Sprintf("%v, %v, %.2f", stats.Messages.BytesSent, stats.Messages.WireBytesSent, r.Ratio(stats.Messages.BytesSent, stats.Messages.WireBytesSent))},
+				[]string{"Received Bytes", "uncompressed, wire, ratio", fmt.Sprintf("%v, %v, %.2f", stats.Messages.BytesReceived, stats.Messages.WireBytesReceived, r.Ratio(stats.Messages.BytesReceived, stats.Messages.WireBytesReceived))},
+			)
+		}
+	}
+
+	//Latencies are only reported when measured, like TLS for wss:// hosts & round trips for messages with a paired response
+	rows = r.AppendLatencyRow(rows, "Connect Time", stats.Latencies["connect"], quantiles)
+	rows = r.AppendLatencyRow(rows, "DNS Time", stats.Latencies["dns"], quantiles)
+	rows = r.AppendLatencyRow(rows, "Overall Time", stats.Latencies["overall"], quantiles)
+	rows = r.AppendLatencyRow(rows, "TLS Time", stats.Latencies["tlsHandshake"], quantiles)
+	rows = r.AppendLatencyRow(rows, "Upgrade Time", stats.Latencies["upgrade"], quantiles)
+	rows = r.AppendLatencyRow(rows, "Round Trip Time", stats.Latencies["roundTrip"], quantiles)
+
+	//Only reported when ping tests were run
+	if stats.Latencies["ping"].Count > 0 || stats.PingTimeouts > 0 {
+		rows = append(rows, []string{"Ping", "pong, timeout", fmt.Sprintf("%v, %v", stats.Latencies["ping"].Count, stats.PingTimeouts)})
+	}
+	rows = r.AppendLatencyRow(rows, "Ping Time", stats.Latencies["ping"], quantiles)
+
+	//Only reported when close tests were run
+	if stats.Latencies["close"].Count > 0 || stats.CloseTimeouts > 0 {
+		rows = append(rows, []string{"Close", "echoed, not echoed", fmt.Sprintf("%v, %v", stats.Latencies["close"].Count, stats.CloseTimeouts)})
+	}
+	rows = r.AppendLatencyRow(rows, "Close Time", stats.Latencies["close"], quantiles)
+
+	rows = AppendCodeRows(rows, "Status Codes", stats.StatusCodes)
+	rows = AppendCodeRows(rows, "Server Close Codes", stats.CloseCodes)
+
+	return rows
+}
+
+//AppendLatencyRow adds a row of the latency with its min, quantiles & max
+func (r *StatsReporter) AppendLatencyRow(rows [][]string, name string, latency models.LatencyResult, quantiles []float64) [][]string {
+
+	//Latencies never measured have no quantiles, like when the test is stopped before any connection is made
+	if latency.Count == 0 {
+		return rows
+	}
+
+	names := []string{"min"}
+	values := []string{r.durationStr(latency.Min).String()}
+
+	for _, quantile := range quantiles {
+		//Saved results only have the quantiles they were saved with
+		if value, ok := latency.Quantiles[QuantileName(quantile)]; ok {
+			names = append(names, QuantileName(quantile))
+			values = append(values, r.durationStr(value).String())
+		}
+	}
+
+	names = append(names, "max")
+	values = append(values, r.durationStr(latency.Max).String())
+
+	return append(rows, []string{name, strings.Join(names, ", "), strings.Join(values, ", ")})
+}
+
+//AppendCodeRows adds a row per code with its count, in order of the codes
+func AppendCodeRows(rows [][]string, name string, codeSet map[int]int) [][]string {
+
+	codes := make([]int, 0, len(codeSet))
+	for code := range codeSet {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	for _, code := range codes {
+		rows = append(rows, []string{name, "code, count", fmt.Sprintf("%v, %v", code, codeSet[code])})
+	}
+
+	return rows
+}
+
 //LogHitrate logs the current hitrate
 func (r *StatsReporter) LogHitrate(hitrate *models.HitRate) {
 
-	if _, err := fmt.Fprintf(r.TabWriter, r.HitrateString, hitrate.StartConnections, hitrate.EndConnections, hitrate.Connections, hitrate.Duration); err != nil {
+	//Concurrency stages are live connections instead of connections per second
+	format := r.HitrateString
+	if TestRunner.ConcurrencyMode {
+		format = r.StageString
+	}
+
+	if _, err := fmt.Fprintf(r.TabWriter, format, hitrate.StartConnections, hitrate.EndConnections, hitrate.Connections, hitrate.Duration); err != nil {
+		fmt.Println("Reporting error", err)
+		return
+	}
+
+	//Flush the tabwriter
+	r.TabWriter.Flush()
+}
+
+//LogScenario logs the scenario
+func (r *StatsReporter) LogScenario(scenario *models.Scenario) {
+
+	if _, err := fmt.Fprintf(r.TabWriter, r.ScenarioString, scenario.Name, scenario.Weight); err != nil {
 		fmt.Println("Reporting error", err)
 		return
 	}
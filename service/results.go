@@ -0,0 +1,182 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/tdigest"
+	"github.com/phantomvivek/kratos/config"
+	"github.com/phantomvivek/kratos/models"
+)
+
+//DefaultQuantiles are the quantiles written to results without quantiles in the config
+var DefaultQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+//ResultQuantiles gets the quantiles for the results, validating the ones in the config
+func ResultQuantiles() []float64 {
+
+	quantiles := config.Config.Output.Quantiles
+	if len(quantiles) == 0 {
+		return DefaultQuantiles
+	}
+
+	for _, quantile := range quantiles {
+		if quantile <= 0 || quantile > 1 {
+			panic(fmt.Sprintf("Invalid quantile found: %v, quantiles are between 0 & 1", quantile))
+		}
+	}
+
+	return quantiles
+}
+
+//QuantileName names the quantile, like p99 for 0.99
+func QuantileName(quantile float64) string {
+	return "p" + strconv.FormatFloat(math.Round(quantile*1e6)/1e4, 'f', -1, 64)
+}
+
+//WriteResults writes the results of the test to the JSON file in the config
+func (r *StatsReporter) WriteResults(path string) {
+
+	data, err := json.MarshalIndent(r.MakeResults(), "", "  ")
+	if err != nil {
+		fmt.Println("Error making results", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		fmt.Println("Error writing results", err)
+	}
+}
+
+//MakeResults makes the results of the test from all stats, stats per hitrate & stats per scenario
+func (r *StatsReporter) MakeResults() *models.Results {
+
+	quantiles := ResultQuantiles()
+
+	mode := "hitrate"
+	if TestRunner.ConcurrencyMode {
+		mode = "concurrency"
+	}
+
+	results := &models.Results{
+		SchemaVersion: models.ResultsSchemaVersion,
+		Run: models.RunInfo{
+			StartTime:       r.StartTime,
+			EndTime:         r.StartTime.Add(r.AllStats.TotalDuration),
+			DurationSeconds: r.AllStats.TotalDuration.Seconds(),
+			Mode:            mode,
+			Stopped:         TestRunner.Stopped(),
+			StopReason:      r.StopReason,
+		},
+		Config:    config.Raw,
+		Quantiles: quantiles,
+		HitRates:  make([]models.HitRateResult, 0, len(r.RateStats)),
+		Scenarios: make([]models.ScenarioResult, 0, len(r.Scenarios)),
+		All:       r.MakeResultStats(r.AllStats, quantiles),
+	}
+
+	for idx := 0; idx < len(r.RateStats); idx++ {
+		hrStat := r.RateStats[idx]
+		results.HitRates = append(results.HitRates, models.HitRateResult{
+			Index:           idx,
+			Start:           hrStat.HitRateRef.StartConnections,
+			End:             hrStat.HitRateRef.EndConnections,
+			DurationSeconds: hrStat.HitRateRef.Duration,
+			Stats:           r.MakeResultStats(hrStat, quantiles),
+		})
+	}
+
+	for _, scenario := range r.Scenarios {
+		results.Scenarios = append(results.Scenarios, models.ScenarioResult{
+			Name:   scenario.Name,
+			Weight: scenario.Weight,
+			Stats:  r.MakeResultStats(r.ScenarioStats[scenario.Name], quantiles),
+		})
+	}
+
+	return results
+}
+
+//MakeResultStats makes the results of a stat object
+func (r *StatsReporter) MakeResultStats(stat *models.HitRateStats, quantiles []float64) models.ResultStats {
+
+	return models.ResultStats{
+		DurationSeconds: stat.TotalDuration.Seconds(),
+		Connections: models.ConnectionResults{
+			Total:      stat.TotalConnections,
+			Success:    int(stat.ConnectSuccess),
+			Failure:    int(stat.ConnectFailure),
+			Timeout:    int(stat.ConnectTimeout),
+			Compressed: stat.CompressedConnections,
+		},
+		Expect: models.ExpectResults{
+			Match:    stat.ExpectMatch,
+			Mismatch: stat.ExpectMismatch,
+			Timeout:  stat.ExpectTimeout,
+		},
+		Extract: models.ExtractResults{
+			Success: stat.ExtractSuccess,
+			Failure: stat.ExtractFailure,
+		},
+		Messages: models.MessageResults{
+			Sent:              stat.MessagesSent,
+			BytesSent:         stat.BytesSent,
+			SendFailures:      stat.SendFailures,
+			Received:          stat.MessagesReceived,
+			BytesReceived:     stat.BytesReceived,
+			ReadErrors:        stat.ReadErrors,
+			WireBytesSent:     stat.WireBytesSent,
+			WireBytesReceived: stat.WireBytesReceived,
+		},
+		Iterations: stat.Iterations,
+		Hold: models.HoldResults{
+			Held:    stat.Held,
+			Dropped: stat.HoldDrops,
+		},
+		PingTimeouts:  stat.PingTimeouts,
+		CloseTimeouts: stat.CloseTimeouts,
+		Latencies: map[string]models.LatencyResult{
+			"connect":      MakeLatencyResult(stat.ConnectLatencies, stat.ConnectLatencyMin, stat.ConnectLatencyMax, quantiles),
+			"dns":          MakeLatencyResult(stat.DNSResolutionLatencies, stat.DNSResolutionLatencyMin, stat.DNSResolutionLatencyMax, quantiles),
+			"overall":      MakeLatencyResult(stat.OverallLatencies, stat.OverallLatencyMin, stat.OverallLatencyMax, quantiles),
+			"tlsHandshake": MakeLatencyResult(stat.TLSHandshakeLatencies, stat.TLSHandshakeLatencyMin, stat.TLSHandshakeLatencyMax, quantiles),
+			"upgrade":      MakeLatencyResult(stat.UpgradeLatencies, stat.UpgradeLatencyMin, stat.UpgradeLatencyMax, quantiles),
+			"roundTrip":    MakeLatencyResult(stat.RoundTripLatencies, stat.RoundTripLatencyMin, stat.RoundTripLatencyMax, quantiles),
+			"ping":         MakeLatencyResult(stat.PingLatencies, stat.PingLatencyMin, stat.PingLatencyMax, quantiles),
+			"close":        MakeLatencyResult(stat.CloseLatencies, stat.CloseLatencyMin, stat.CloseLatencyMax, quantiles),
+		},
+		StatusCodes: stat.StatusCodes,
+		CloseCodes:  stat.CloseCodes,
+		Errors:      stat.ErrorSet,
+	}
+}
+
+//MakeLatencyResult makes a latency result in milliseconds, empty latencies have no quantiles
+func MakeLatencyResult(latencies *tdigest.TDigest, min float64, max float64, quantiles []float64) models.LatencyResult {
+
+	result := models.LatencyResult{
+		Count:     int(latencies.Count()),
+		Min:       Milliseconds(min),
+		Max:       Milliseconds(max),
+		Quantiles: make(map[string]float64),
+	}
+
+	for _, quantile := range quantiles {
+		value := latencies.Quantile(quantile)
+		if math.IsNaN(value) {
+			break
+		}
+		result.Quantiles[QuantileName(quantile)] = Milliseconds(value)
+	}
+
+	return result
+}
+
+//Milliseconds converts nanoseconds to milliseconds
+func Milliseconds(nanoseconds float64) float64 {
+	return nanoseconds / float64(time.Millisecond)
+}
@@ -2,24 +2,63 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/phantomvivek/kratos/config"
 	"github.com/phantomvivek/kratos/models"
 )
 
 //Socket = single socket connection to the host
 type Socket struct {
-	Connection  *websocket.Conn
-	Dialer      *websocket.Dialer
-	SocketStats *models.SocketStats
-	Context     context.Context
+	ReadCount       int64
+	ReadBytes       int64
+	ReadErrors      int64
+	ServerCloseCode int64
+	Connection      *websocket.Conn
+	Dialer          *websocket.Dialer
+	Wire            *WireCounter
+	WireRead        int64
+	WireWritten     int64
+	SocketStats     *models.SocketStats
+	Context         context.Context
+	Variables       map[string][]byte
+	Inbox           chan *InboundMessage
+	Pongs           chan string
+	ReadDone        chan struct{}
+	StepDelay       time.Duration
+	StepAt          time.Time
+	PreviousStepAt  time.Time
+	Closing         int32
+	Shedding        int32
+	ShedChan        chan struct{}
 }
 
+//InboundMessage is a message received from the host by the read loop
+type InboundMessage struct {
+	Data       []byte
+	ReceivedAt time.Time
+}
+
+//DefaultExpectTimeout is the time to wait for a message from the host when a test has no timeout
+const DefaultExpectTimeout = 10 * time.Second
+
+//DefaultStepDelay is the delay after every test when the config has no step delay
+const DefaultStepDelay = 10 * time.Millisecond
+
+//InboxSize is the number of received messages buffered for expect tests, older messages are dropped when full
+const InboxSize = 64
+
 //ContextKey used for getting ref out of context
 type ContextKey string
 
@@ -29,6 +68,7 @@ func CustomDialer(ctx context.Context, network, addr string) (net.Conn, error) {
 	//These variables will always be set
 	statsRef, ok := ctx.Value(ContextKey("StatsRef")).(*models.SocketStats)
 	timeout, _ := ctx.Value(ContextKey("Timeout")).(int)
+	wireCounter, _ := ctx.Value(ContextKey("WireCounter")).(*WireCounter)
 
 	var connectStart time.Time
 	var dnsStart time.Time
@@ -81,6 +121,7 @@ func CustomDialer(ctx context.Context, network, addr string) (net.Conn, error) {
 		statsRef.OverallTime = overallDiff
 		if err != nil {
 			statsRef.Success = false
+			statsRef.Timeout = IsTimeout(err)
 			statsRef.ErrorString = err.Error()
 		} else {
 			statsRef.Success = true
@@ -91,26 +132,70 @@ func CustomDialer(ctx context.Context, network, addr string) (net.Conn, error) {
 		return conn, err
 	}
 
+	if wireCounter != nil {
+		return &CountingConn{Conn: conn, Counter: wireCounter}, nil
+	}
+
 	return conn, nil
 }
 
+//IsTimeout checks if a dial or handshake error was due to a timeout
+func IsTimeout(err error) bool {
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
 //SocketRun goroutine that makes a socket collection with the host and starts the tests
-func SocketRun(hostURL string, timeout int, tests []*models.Test, dataIdx int, doneChan chan bool, errChan chan error, hitIdx int, reporterChan chan *models.SocketStats) {
+func SocketRun(dialer *websocket.Dialer, hostURL string, header http.Header, timeout int, scenario *models.Scenario, connID int, dataIdx int, doneChan chan bool, errChan chan error, hitIdx int, reporterChan chan *models.SocketStats) {
 
 	socket := Socket{
-		Dialer: &websocket.Dialer{
-			HandshakeTimeout: 10 * time.Second,
-			NetDialContext:   CustomDialer,
-		},
+		Dialer: dialer,
 		SocketStats: &models.SocketStats{
+			ConnectionID: connID,
+			Timestamp:    time.Now(),
 			HitrateIndex: hitIdx,
+			Scenario:     scenario.Name,
 		},
+		Variables: make(map[string][]byte),
+		Inbox:     make(chan *InboundMessage, InboxSize),
+		Pongs:     make(chan string, InboxSize),
+		ReadDone:  make(chan struct{}),
+		ShedChan:  make(chan struct{}),
+		StepDelay: TestRunner.StepDelay,
+	}
+
+	//Wire bytes are only counted for ws:// hosts, as the network connection of wss:// hosts has TLS overhead
+	if strings.HasPrefix(strings.ToLower(hostURL), "ws://") {
+		socket.Wire = &WireCounter{}
 	}
 
 	socket.Context = context.WithValue(context.Background(), ContextKey("StatsRef"), socket.SocketStats)
 	socket.Context = context.WithValue(socket.Context, ContextKey("Timeout"), timeout)
+	socket.Context = context.WithValue(socket.Context, ContextKey("WireCounter"), socket.Wire)
+
+	err := socket.Connect(hostURL, header)
+
+	//Stop conditions & prometheus counters use the connect as it happens, the socket stats are only reported once all tests are done
+	if len(Reporter.StopChecks) > 0 || Reporter.Prometheus != nil {
+		Reporter.ConnectChan <- &models.ConnectEvent{
+			At:           time.Now(),
+			HitrateIndex: hitIdx,
+			Scenario:     scenario.Name,
+			Success:      err == nil,
+			Timeout:      socket.SocketStats.Timeout,
+			ConnectTime:  socket.SocketStats.ConnectTime,
+		}
+	}
 
-	err := socket.Connect(hostURL)
 	if err != nil {
 		errChan <- err
 		doneChan <- true
@@ -121,24 +206,142 @@ func SocketRun(hostURL string, timeout int, tests []*models.Test, dataIdx int, d
 		return
 	}
 
-	socket.DoTests(tests, dataIdx)
+	//Pongs are handled by the read loop, pass them on to ping tests
+	socket.Connection.SetPongHandler(func(payload string) error {
+		socket.Wire.CountControlRead(len(payload))
+		select {
+		case socket.Pongs <- payload:
+		default:
+			//Nobody is waiting for pongs
+		}
+		return nil
+	})
+
+	//Pings & close frames from the host are answered like the default handlers, counting the control frames
+	socket.Connection.SetPingHandler(func(payload string) error {
+		socket.Wire.CountControlRead(len(payload))
+
+		err := socket.WriteControl(websocket.PongMessage, []byte(payload), time.Now().Add(time.Second))
+		if netErr, ok := err.(net.Error); err == websocket.ErrCloseSent || (ok && netErr.Temporary()) {
+			return nil
+		}
+		return err
+	})
+	socket.Connection.SetCloseHandler(func(code int, text string) error {
+		payload := 0
+		if code != websocket.CloseNoStatusReceived {
+			payload = 2 + len(text)
+		}
+		socket.Wire.CountControlRead(payload)
+
+		socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		return nil
+	})
+
+	//Connected sockets are tracked by the runner till the connection closes
+	TestRunner.AddSocket(&socket)
+
+	//Keep reading from the host so control frames are processed & received messages are counted
+	go socket.ReadLoop()
+
+	socket.DoTests(scenario.Tests, dataIdx)
 
+	//Sockets shed from here on were done anyway, so they are not counted as shed
+	shed := !atomic.CompareAndSwapInt32(&socket.Shedding, 0, 2)
+
+	if atomic.LoadInt32(&socket.Closing) == 0 {
+		if TestRunner.Stopped() {
+			//Tests stopped midway need the connection closed, as the host is going away
+			socket.Close(&models.Test{CloseCode: websocket.CloseGoingAway})
+		} else if TestRunner.ConcurrencyMode {
+			//Concurrency stages replace done sockets & close shed ones, so they must not stay connected
+			socket.Close(&models.Test{})
+		}
+	}
+
+	socket.CollectReadStats()
 	reporterChan <- socket.SocketStats
 
 	//Tests would be complete
 	doneChan <- true
+
+	if shed {
+		atomic.AddInt64(&TestRunner.ShedCount, -1)
+	}
+}
+
+//Shed stops the tests of the socket for it to be closed, returns false if the socket is already done with its tests
+func (s *Socket) Shed() bool {
+
+	if !atomic.CompareAndSwapInt32(&s.Shedding, 0, 1) {
+		return false
+	}
+
+	close(s.ShedChan)
+	return true
+}
+
+//Stopping checks if the tests of the socket are to be stopped, as the test is stopped or the socket is shed
+func (s *Socket) Stopping() bool {
+	return TestRunner.Stopped() || atomic.LoadInt32(&s.Shedding) == 1
 }
 
 //Connect connect the ws to host
-func (s *Socket) Connect(url string) error {
+func (s *Socket) Connect(url string, header http.Header) error {
+
+	var tlsStart time.Time
+	var upgradeStart time.Time
+
+	//Trace the TLS handshake & the upgrade request which happen after the dial
+	ctTrace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			upgradeStart = time.Now()
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			s.SocketStats.TLSHandshakeTime = time.Since(tlsStart)
 
-	conn, _, err := s.Dialer.DialContext(s.Context, url, nil)
+			//Upgrade request is written once the TLS handshake is done
+			upgradeStart = time.Now()
+		},
+	}
+	traceCtx := httptrace.WithClientTrace(s.Context, ctTrace)
+
+	conn, resp, err := s.Dialer.DialContext(traceCtx, url, header)
 	if err != nil {
+		//Dial may have succeeded, but the TLS handshake or the upgrade failed
+		s.SocketStats.Success = false
+		s.SocketStats.Timeout = IsTimeout(err)
+		s.SocketStats.ErrorString = err.Error()
+
+		//Bad handshakes come with the response from the host
+		if resp != nil {
+			s.SocketStats.StatusCode = resp.StatusCode
+		}
+
 		//return err to the error channel
 		//fmt.Println("Error in connection", err)
 		return err
 	}
 
+	s.SocketStats.UpgradeTime = time.Since(upgradeStart)
+
+	//Permessage-deflate is used only if the host agreed to it
+	if s.Dialer.EnableCompression {
+		s.SocketStats.Compressed = strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+		if s.SocketStats.Compressed && config.Config.Config.CompressionLevel != 0 {
+			conn.SetCompressionLevel(config.Config.Config.CompressionLevel)
+		}
+	}
+
+	//Handshake bytes are not counted as message bytes on the wire
+	if s.Wire != nil {
+		s.WireRead = atomic.LoadInt64(&s.Wire.BytesRead)
+		s.WireWritten = atomic.LoadInt64(&s.Wire.BytesWritten)
+	}
+
 	s.Connection = conn
 	return nil
 }
@@ -148,38 +351,413 @@ func (s *Socket) DoTests(tests []*models.Test, dataIdx int) {
 
 	for _, test := range tests {
 
+		//No more tests are run once the test is stopped
+		if s.Stopping() {
+			return
+		}
+
+		//Expect tests only take messages received from the previous step on
+		s.PreviousStepAt = s.StepAt
+		s.StepAt = time.Now()
+
 		if test.Type == "message" {
 
 			var msg json.RawMessage
-			if test.ReplaceStr {
+			if test.ReplaceStr && test.Data != nil {
 				msg = test.Data.DataArray[dataIdx]
 			} else {
 				msg = test.SendJSON
 			}
+
+			//Replace variables captured from previous messages of the host
+			if test.ReplaceStr {
+				msg = s.ReplaceVariables(msg, test.Variables)
+			}
+
 			//Need to send message to the host
-			err := s.Connection.WriteMessage(websocket.TextMessage, msg)
-			if err != nil {
-				//Log error
-				fmt.Println("Error occured in sending message to host", err)
+			s.SendMessage(test, websocket.TextMessage, msg)
+		} else if test.Type == "binary" {
+
+			payload := test.Payload
+			if test.Data != nil && len(test.Data.BinaryArray) > 0 {
+				payload = test.Data.BinaryArray[dataIdx]
 			}
-		} else if test.Type == "sleep" {
 
-			//Sleep for so many seconds
-			localTimer := time.NewTimer(time.Duration(test.Duration) * time.Second)
-			<-localTimer.C
-		} else if test.Type == "disconnect" {
+			s.SendMessage(test, websocket.BinaryMessage, payload)
+		} else if test.Type == "sleep" {
 
-			//Need to disconnect the socket
-			err := s.Connection.Close()
-			if err != nil {
-				fmt.Println("Error in closing")
+			//Sleep for the duration, or a random think time
+			duration := time.Duration(test.Duration)
+			if test.Think != nil {
+				duration = ThinkDuration(test.Think)
 			}
 
+			s.Sleep(duration, time.Duration(test.PingInterval))
+		} else if test.Type == "ping" {
+
+			//Ping the host & wait for the pong
+			s.Ping(test)
+		} else if test.Type == "expect" {
+
+			//Wait for a message from the host & match it, replies to the previous step may already be in
+			s.Expect(test, s.PreviousStepAt)
+		} else if test.Type == "repeat" {
+
+			//Run the nested tests over & over
+			s.Repeat(test, dataIdx)
+		} else if test.Type == "hold" {
+
+			//Keep the connection open till the end of the test, then close it
+			s.Hold(test)
+		} else if test.Type == "close" || test.Type == "disconnect" {
+
+			//Need to disconnect the socket with a close handshake
+			s.Close(test)
 		} else {
 			fmt.Println("Invalid type found", test.Type)
 		}
 
-		delay := time.NewTimer(10 * time.Millisecond)
-		<-delay.C
+		if s.StepDelay > 0 {
+			delay := time.NewTimer(s.StepDelay)
+			<-delay.C
+		}
+	}
+}
+
+//Repeat runs the nested tests for the count of iterations or till the duration is over, whichever is first
+func (s *Socket) Repeat(test *models.Test, dataIdx int) {
+
+	var endTime time.Time
+	if test.Duration > 0 {
+		endTime = time.Now().Add(time.Duration(test.Duration))
+	}
+
+	//Without a count, repeats till the duration is over
+	for i := 0; test.Count == 0 || i < test.Count; i++ {
+		if !endTime.IsZero() && time.Now().After(endTime) {
+			break
+		}
+
+		if s.Stopping() {
+			break
+		}
+
+		s.DoTests(test.Steps, dataIdx)
+		s.SocketStats.Iterations++
+	}
+}
+
+//SendMessage sends a message to the host & waits for its paired response if the test expects one
+func (s *Socket) SendMessage(test *models.Test, messageType int, msg []byte) {
+
+	sentAt := time.Now()
+	err := s.Connection.WriteMessage(messageType, msg)
+	if err != nil {
+		s.SocketStats.SendFailures++
+		return
+	}
+
+	s.SocketStats.MessagesSent++
+	s.SocketStats.BytesSent += int64(len(msg))
+
+	if test.Expect != nil || len(test.Extract) > 0 {
+
+		//Wait for the paired response & measure the round trip time, messages received before the write can't be the reply
+		if matched, receivedAt := s.Expect(test, sentAt); matched {
+			s.SocketStats.RoundTripTimes = append(s.SocketStats.RoundTripTimes, receivedAt.Sub(sentAt))
+		}
+	}
+}
+
+//Close sends a close frame to the host & waits for the host to echo it, before closing the connection
+func (s *Socket) Close(test *models.Test) {
+
+	timeout := DefaultExpectTimeout
+	if test.Timeout > 0 {
+		timeout = time.Duration(test.Timeout) * time.Second
+	}
+
+	code := test.CloseCode
+	if code == 0 {
+		code = websocket.CloseNormalClosure
+	}
+
+	sent, closeTime := s.CloseHandshake(code, test.CloseReason, timeout)
+	if !sent {
+		return
+	}
+
+	if closeTime > 0 {
+		s.SocketStats.CloseTime = closeTime
+	} else {
+		s.SocketStats.CloseTimeout = true
+	}
+}
+
+//CloseHandshake sends a close frame & waits for the host to echo it, before closing the connection, only once per socket.
+//Returns if the close frame was sent, with the time taken for the echo or 0 if the host never echoed it
+func (s *Socket) CloseHandshake(code int, reason string, timeout time.Duration) (bool, time.Duration) {
+
+	//The runner closes idle sockets when the test is stopped, so a socket may be closed from two places
+	if !atomic.CompareAndSwapInt32(&s.Closing, 0, 1) {
+		return false, 0
+	}
+
+	defer func() {
+		if err := s.Connection.Close(); err != nil {
+			fmt.Println("Error in closing")
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	closeStart := time.Now()
+	err := s.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), closeStart.Add(timeout))
+
+	//Close frame can't be sent if the host already closed the connection
+	if err != nil {
+		return false, 0
+	}
+
+	select {
+	case <-s.ReadDone:
+		return true, time.Since(closeStart)
+	case <-timer.C:
+		return true, 0
+	}
+}
+
+//Idle checks if the socket is done with its tests, but still connected
+func (s *Socket) Idle() bool {
+	return atomic.LoadInt32(&s.Shedding) == 2 && atomic.LoadInt32(&s.Closing) == 0
+}
+
+//Hold keeps the connection open till held sockets are released at the end of the test, then closes it with a close handshake
+func (s *Socket) Hold(test *models.Test) {
+
+	s.SocketStats.Held = true
+
+	var pings <-chan time.Time
+	if test.PingInterval > 0 {
+		ticker := time.NewTicker(time.Duration(test.PingInterval))
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+
+	for {
+		select {
+		case <-TestRunner.HoldChan:
+			s.Close(test)
+			return
+		case <-s.ShedChan:
+			s.Close(test)
+			return
+		case <-s.ReadDone:
+			//Host closed or dropped the connection while it was held
+			s.SocketStats.HoldDropped = true
+			s.Connection.Close()
+			return
+		case <-pings:
+			//Pongs for these are not measured
+			s.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Duration(test.PingInterval)))
+		}
+	}
+}
+
+//Sleep waits for the duration, pinging the host every interval to keep the connection alive if the interval is set
+func (s *Socket) Sleep(duration time.Duration, pingInterval time.Duration) {
+
+	localTimer := time.NewTimer(duration)
+	defer localTimer.Stop()
+
+	var pings <-chan time.Time
+	if pingInterval > 0 {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+
+	for {
+		select {
+		case <-localTimer.C:
+			return
+		case <-TestRunner.StopChan:
+			return
+		case <-s.ShedChan:
+			return
+		case <-pings:
+			//Pongs for these are not measured
+			s.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingInterval))
+		}
+	}
+}
+
+//Ping sends a ping to the host and measures the time taken for the pong
+func (s *Socket) Ping(test *models.Test) {
+
+	timeout := DefaultExpectTimeout
+	if test.Timeout > 0 {
+		timeout = time.Duration(test.Timeout) * time.Second
+	}
+
+	//Pongs echo the payload, a unique payload tells this ping's pong apart
+	payload := test.PingPayload
+	if payload == "" {
+		payload = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	sentAt := time.Now()
+	if err := s.WriteControl(websocket.PingMessage, []byte(payload), sentAt.Add(timeout)); err != nil {
+		s.SocketStats.PingTimeouts++
+		return
+	}
+
+	for {
+		select {
+		case pong := <-s.Pongs:
+			if pong != payload {
+				//Pong of an older ping
+				continue
+			}
+			s.SocketStats.PingTimes = append(s.SocketStats.PingTimes, time.Since(sentAt))
+			return
+		case <-timer.C:
+			s.SocketStats.PingTimeouts++
+			return
+		case <-TestRunner.StopChan:
+			return
+		case <-s.ShedChan:
+			return
+		}
+	}
+}
+
+//Expect waits for a message from the host received after since, that matches the test's matcher.
+//Messages that don't match are skipped till the timeout. Returns if a message matched along with the time it was received
+func (s *Socket) Expect(test *models.Test, since time.Time) (bool, time.Time) {
+
+	timeout := DefaultExpectTimeout
+	if test.Timeout > 0 {
+		timeout = time.Duration(test.Timeout) * time.Second
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	//Messages were received but none matched, reported as a mismatch instead of a timeout
+	mismatched := false
+
+	for {
+		select {
+		case msg, ok := <-s.Inbox:
+			if !ok {
+				//Read loop has stopped, no more messages will come from the host
+				s.SocketStats.ExpectMismatch++
+				return false, time.Now()
+			}
+
+			//Stale messages, like pushes from before the step, are dropped
+			if msg.ReceivedAt.Before(since) {
+				continue
+			}
+
+			//A test with only extractors matches any message
+			if test.Expect == nil || MatchMessage(test.Expect, msg.Data) {
+				s.SocketStats.ExpectMatch++
+				s.ExtractVariables(test.Extract, msg.Data)
+				return true, msg.ReceivedAt
+			}
+
+			mismatched = true
+		case <-timer.C:
+			if mismatched {
+				s.SocketStats.ExpectMismatch++
+			} else {
+				s.SocketStats.ExpectTimeout++
+			}
+			return false, time.Now()
+		case <-TestRunner.StopChan:
+			return false, time.Now()
+		case <-s.ShedChan:
+			return false, time.Now()
+		}
+	}
+}
+
+//ReadLoop reads messages from the host till the connection closes. Pings are answered by the ping handler
+func (s *Socket) ReadLoop() {
+
+	defer close(s.ReadDone)
+	defer close(s.Inbox)
+	defer TestRunner.RemoveSocket(s)
+
+	for {
+		_, msg, err := s.Connection.ReadMessage()
+		if err != nil {
+			//Errors from closing the socket ourselves are not read errors
+			if atomic.LoadInt32(&s.Closing) == 1 {
+				return
+			}
+
+			//Host closed the connection with a close frame, anything else is an abnormal closure
+			if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code != websocket.CloseAbnormalClosure {
+				atomic.StoreInt64(&s.ServerCloseCode, int64(closeErr.Code))
+			} else {
+				atomic.AddInt64(&s.ReadErrors, 1)
+			}
+			return
+		}
+
+		atomic.AddInt64(&s.ReadCount, 1)
+		atomic.AddInt64(&s.ReadBytes, int64(len(msg)))
+
+		s.Deliver(&InboundMessage{Data: msg, ReceivedAt: time.Now()})
 	}
 }
+
+//Deliver buffers the message for expect tests, dropping the oldest message when the inbox is full
+func (s *Socket) Deliver(msg *InboundMessage) {
+
+	for {
+		select {
+		case s.Inbox <- msg:
+			return
+		default:
+			//Expect tests may have read a message meanwhile, so this doesn't block
+			select {
+			case <-s.Inbox:
+			default:
+			}
+		}
+	}
+}
+
+//CollectReadStats copies the read loop & wire counters to the socket stats
+func (s *Socket) CollectReadStats() {
+
+	s.SocketStats.MessagesReceived = atomic.LoadInt64(&s.ReadCount)
+	s.SocketStats.BytesReceived = atomic.LoadInt64(&s.ReadBytes)
+	s.SocketStats.ReadErrors = atomic.LoadInt64(&s.ReadErrors)
+	s.SocketStats.ServerCloseCode = int(atomic.LoadInt64(&s.ServerCloseCode))
+
+	//Only message frames are counted, so compression ratios are of messages
+	if s.Wire != nil {
+		s.SocketStats.WireBytesReceived = atomic.LoadInt64(&s.Wire.BytesRead) - s.WireRead - atomic.LoadInt64(&s.Wire.ControlBytesRead)
+		s.SocketStats.WireBytesSent = atomic.LoadInt64(&s.Wire.BytesWritten) - s.WireWritten - atomic.LoadInt64(&s.Wire.ControlBytesWritten)
+	}
+}
+
+//WriteControl writes a control frame to the host, counting it so control frames are not counted as message bytes on the wire
+func (s *Socket) WriteControl(messageType int, data []byte, deadline time.Time) error {
+
+	err := s.Connection.WriteControl(messageType, data, deadline)
+	if err == nil {
+		s.Wire.CountControlWritten(len(data))
+	}
+
+	return err
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/tdigest"
+	"github.com/phantomvivek/kratos/models"
+)
+
+//DefaultStopWindow is the sliding window of error rate conditions without a window
+const DefaultStopWindow = 10 * time.Second
+
+//DefaultStopMinConnections is the number of connections needed before rates & latencies are checked
+const DefaultStopMinConnections = 10
+
+//ConnectionResult is the outcome of a connection, kept for the sliding window of error rate conditions
+type ConnectionResult struct {
+	At     time.Time
+	Failed bool
+}
+
+//StopCheck keeps the state of a stop condition as connect events come in
+type StopCheck struct {
+	Condition           *models.StopCondition
+	Results             []ConnectionResult
+	FailedResults       int
+	ConsecutiveFailures int
+	Connections         int
+	ConnectLatencies    *tdigest.TDigest
+}
+
+//PrepareStopChecks validates the stop conditions, sets their defaults & makes a check for each
+func PrepareStopChecks(conditions []*models.StopCondition) []*StopCheck {
+
+	checks := make([]*StopCheck, 0, len(conditions))
+	for _, condition := range conditions {
+
+		if condition.MinConnections == 0 {
+			condition.MinConnections = DefaultStopMinConnections
+		}
+
+		switch condition.Type {
+		case "errorRate":
+			if condition.Percent <= 0 || condition.Percent > 100 {
+				panic(fmt.Sprintf("Stop condition errorRate needs a percent between 0 & 100, found: %v", condition.Percent))
+			}
+			if condition.Window == 0 {
+				condition.Window = models.Duration(DefaultStopWindow)
+			}
+		case "connectLatency":
+			if condition.Latency <= 0 {
+				panic("Stop condition connectLatency needs a latency greater than 0")
+			}
+			if condition.Quantile == 0 {
+				//Defaults to p99
+				condition.Quantile = 0.99
+			}
+			if condition.Quantile < 0 || condition.Quantile > 1 {
+				panic(fmt.Sprintf("Stop condition connectLatency needs a quantile between 0 & 1, found: %v", condition.Quantile))
+			}
+		case "consecutiveFailures":
+			if condition.Count <= 0 {
+				panic("Stop condition consecutiveFailures needs a count greater than 0")
+			}
+		default:
+			panic(fmt.Sprintf("Invalid stop condition type found: %s", condition.Type))
+		}
+
+		checks = append(checks, &StopCheck{Condition: condition, ConnectLatencies: tdigest.NewWithCompression(100)})
+	}
+
+	return checks
+}
+
+//Check adds the connect event to the state of the condition & returns the reason to stop, if the condition is met
+func (c *StopCheck) Check(event *models.ConnectEvent) string {
+
+	condition := c.Condition
+	failed := !event.Success
+
+	switch condition.Type {
+	case "errorRate":
+		now := event.At
+		c.Results = append(c.Results, ConnectionResult{At: now, Failed: failed})
+		if failed {
+			c.FailedResults++
+		}
+
+		//Drop results older than the window
+		windowStart := now.Add(-time.Duration(condition.Window))
+		drop := 0
+		for drop < len(c.Results) && c.Results[drop].At.Before(windowStart) {
+			if c.Results[drop].Failed {
+				c.FailedResults--
+			}
+			drop++
+		}
+		c.Results = c.Results[drop:]
+
+		if len(c.Results) < condition.MinConnections {
+			return ""
+		}
+
+		rate := float64(c.FailedResults) * 100 / float64(len(c.Results))
+		if rate > condition.Percent {
+			return fmt.Sprintf("errorRate: %.2f%% of %v connections failed in the last %v, above %v%%", rate, len(c.Results), time.Duration(condition.Window), condition.Percent)
+		}
+	case "connectLatency":
+		c.Connections++
+		c.ConnectLatencies.Add(float64(event.ConnectTime), 1)
+
+		if c.Connections < condition.MinConnections {
+			return ""
+		}
+
+		latency := time.Duration(c.ConnectLatencies.Quantile(condition.Quantile))
+		if latency > time.Duration(condition.Latency) {
+			return fmt.Sprintf("connectLatency: p%v connect time of %v, above %v", condition.Quantile*100, latency, time.Duration(condition.Latency))
+		}
+	case "consecutiveFailures":
+		if !failed {
+			c.ConsecutiveFailures = 0
+			return ""
+		}
+
+		c.ConsecutiveFailures++
+		if c.ConsecutiveFailures >= condition.Count {
+			return fmt.Sprintf("consecutiveFailures: %v connections failed in a row", c.ConsecutiveFailures)
+		}
+	}
+
+	return ""
+}
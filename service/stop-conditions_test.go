@@ -0,0 +1,107 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//connectEvents makes connect events a millisecond apart, every tenth one failed like a host rejecting 10% of handshakes
+func connectEvents(start time.Time, count int) []*models.ConnectEvent {
+
+	events := make([]*models.ConnectEvent, 0, count)
+	for i := 0; i < count; i++ {
+		events = append(events, &models.ConnectEvent{
+			At:          start.Add(time.Duration(i) * time.Millisecond),
+			Success:     i%10 != 9,
+			ConnectTime: time.Millisecond,
+		})
+	}
+
+	return events
+}
+
+func TestCheckErrorRateCountsSuccessesAsTheyConnect(t *testing.T) {
+
+	checks := PrepareStopChecks([]*models.StopCondition{{Type: "errorRate", Percent: 50}})
+
+	//Successful sockets are still running their tests, but their connects are already known
+	for _, event := range connectEvents(time.Now(), 1000) {
+		if reason := checks[0].Check(event); reason != "" {
+			t.Fatalf("Expected no stop at a 10%% error rate, got: %s", reason)
+		}
+	}
+}
+
+func TestCheckErrorRateStopsAboveThePercent(t *testing.T) {
+
+	checks := PrepareStopChecks([]*models.StopCondition{{Type: "errorRate", Percent: 5}})
+
+	reason := ""
+	for _, event := range connectEvents(time.Now(), 1000) {
+		if reason = checks[0].Check(event); reason != "" {
+			break
+		}
+	}
+
+	if reason == "" {
+		t.Fatal("Expected a stop at a 10% error rate, above 5%")
+	}
+}
+
+func TestCheckErrorRateDropsResultsOutsideTheWindow(t *testing.T) {
+
+	condition := &models.StopCondition{Type: "errorRate", Percent: 50, Window: models.Duration(time.Second)}
+	checks := PrepareStopChecks([]*models.StopCondition{condition})
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		checks[0].Check(&models.ConnectEvent{At: start, Success: false})
+	}
+
+	//Failures are out of the window by the time the successes come in
+	later := start.Add(2 * time.Second)
+	for _, event := range connectEvents(later, 20) {
+		if reason := checks[0].Check(event); reason != "" {
+			t.Fatalf("Expected failures out of the window to be dropped, got: %s", reason)
+		}
+	}
+}
+
+func TestCheckConsecutiveFailuresResetOnSuccess(t *testing.T) {
+
+	checks := PrepareStopChecks([]*models.StopCondition{{Type: "consecutiveFailures", Count: 2}})
+
+	for _, event := range connectEvents(time.Now(), 1000) {
+		if reason := checks[0].Check(event); reason != "" {
+			t.Fatalf("Expected no stop with failures between successes, got: %s", reason)
+		}
+	}
+
+	checks[0].Check(&models.ConnectEvent{At: time.Now()})
+	if reason := checks[0].Check(&models.ConnectEvent{At: time.Now()}); reason == "" {
+		t.Fatal("Expected a stop after 2 failures in a row")
+	}
+}
+
+func TestCheckConnectLatency(t *testing.T) {
+
+	condition := &models.StopCondition{Type: "connectLatency", Latency: models.Duration(100 * time.Millisecond)}
+	checks := PrepareStopChecks([]*models.StopCondition{condition})
+
+	for _, event := range connectEvents(time.Now(), 100) {
+		if reason := checks[0].Check(event); reason != "" {
+			t.Fatalf("Expected no stop with 1ms connect times, got: %s", reason)
+		}
+	}
+
+	reason := ""
+	for i := 0; i < 100 && reason == ""; i++ {
+		reason = checks[0].Check(&models.ConnectEvent{At: time.Now(), Success: true, ConnectTime: time.Second})
+	}
+
+	if reason == "" {
+		t.Fatal("Expected a stop once the p99 connect time is above 100ms")
+	}
+}
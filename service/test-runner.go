@@ -1,10 +1,20 @@
 package service
 
 import (
+	"compress/flate"
 	"fmt"
 	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/phantomvivek/kratos/config"
 	"github.com/phantomvivek/kratos/models"
 )
@@ -13,14 +23,34 @@ import (
 type Runner struct {
 	TestDoneChan    chan bool
 	SocketDoneChan  chan bool
-	SocketDoneCount int
+	SocketDoneCount int64
+	OpenDoneChan    chan struct{}
+	HoldChan        chan struct{}
+	HoldDuration    time.Duration
+	StopChan        chan struct{}
+	StopOnce        sync.Once
+	FinishOnce      sync.Once
+	GracePeriod     time.Duration
+	OpeningDone     bool
+	OpenedCount     int
 	TotalCount      int
+	ConcurrencyMode bool
+	Sockets         map[*Socket]bool
+	SocketsLock     sync.Mutex
+	IdleClosedChan  chan struct{}
+	ShedCount       int64
 	ErrChan         chan error
 	HostURL         string
 	ConnectTimeout  int
+	Dialers         []*websocket.Dialer
+	DialerIndex     int
+	Headers         []http.Header
+	StepDelay       time.Duration
 	MaxDataLength   int
 	DataIndex       int
 	Tests           []*models.Test
+	Scenarios       []*models.Scenario
+	TotalWeight     float64
 	HitRates        []models.HitRate
 	Flows           []models.ConnectionBucket
 }
@@ -28,12 +58,20 @@ type Runner struct {
 //TestRunner singleton runner that will run tests
 var TestRunner Runner
 
+//DefaultGracePeriod is the time given to connections to close once the test is stopped
+const DefaultGracePeriod = 5 * time.Second
+
 //Initialize initializes the runner with config and channels
 func (r *Runner) Initialize() {
 	TestRunner = Runner{
 		ErrChan:         make(chan error),
 		TestDoneChan:    make(chan bool, 1),
 		SocketDoneChan:  make(chan bool, 1),
+		OpenDoneChan:    make(chan struct{}),
+		HoldChan:        make(chan struct{}),
+		StopChan:        make(chan struct{}),
+		IdleClosedChan:  make(chan struct{}),
+		Sockets:         make(map[*Socket]bool),
 		TotalCount:      0,
 		SocketDoneCount: 0,
 		MaxDataLength:   0,
@@ -43,6 +81,12 @@ func (r *Runner) Initialize() {
 		HitRates:        config.Config.HitRates,
 	}
 
+	//Concurrency stages keep a number of live sockets, instead of opening sockets at a rate
+	if len(config.Config.Concurrency) > 0 {
+		TestRunner.HitRates = config.Config.Concurrency
+		TestRunner.ConcurrencyMode = true
+	}
+
 	TestRunner.Tests = make([]*models.Test, 0)
 
 	for _, test := range config.Config.Tests {
@@ -50,10 +94,75 @@ func (r *Runner) Initialize() {
 		TestRunner.Tests = append(TestRunner.Tests, &testRef)
 	}
 
+	TestRunner.PrepareScenarios()
+
+	//Compile matchers for tests expecting messages from the host
+	PrepareMatchers(TestRunner.AllTests())
+	PrepareThinkTimes(TestRunner.AllTests())
+	PrepareSteps(TestRunner.AllTests())
+
+	//Quantiles are validated before the test, as results are only written at the end
+	ResultQuantiles()
+
+	//Stop conditions are checked by the reporter as metrics come in
+	Reporter.StopChecks = PrepareStopChecks(config.Config.StopConditions)
+
+	//Think times are random for every run
+	rand.Seed(time.Now().UnixNano())
+
+	//Defaults to 10 milliseconds, can be set to 0
+	TestRunner.StepDelay = DefaultStepDelay
+	if config.Config.StepDelay != nil {
+		TestRunner.StepDelay = time.Duration(*config.Config.StepDelay)
+	}
+
+	//Held sockets are released right after the last socket is opened, unless set
+	if config.Config.Hold != nil {
+		TestRunner.HoldDuration = time.Duration(*config.Config.Hold)
+	}
+
+	//Defaults to 5 seconds
+	TestRunner.GracePeriod = DefaultGracePeriod
+	if config.Config.GracePeriod != nil {
+		TestRunner.GracePeriod = time.Duration(*config.Config.GracePeriod)
+	}
+
 	//Defaults to 10 seconds
 	if TestRunner.ConnectTimeout == 0 {
 		TestRunner.ConnectTimeout = 10
 	}
+
+	//Defaults to 10 seconds
+	handshakeTimeout := config.Config.Config.HandshakeTimeout
+	if handshakeTimeout == 0 {
+		handshakeTimeout = 10
+	}
+
+	//Levels are checked before the test, as they are only set once connected
+	level := config.Config.Config.CompressionLevel
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		panic(fmt.Sprintf("Invalid compression level found: %v, levels are from %v to %v", level, flate.HuffmanOnly, flate.BestCompression))
+	}
+
+	//Dialers are shared by all sockets, as they are safe for concurrent use
+	dialer := websocket.Dialer{
+		HandshakeTimeout:  time.Duration(handshakeTimeout) * time.Second,
+		NetDialContext:    CustomDialer,
+		Subprotocols:      config.Config.Config.Subprotocols,
+		EnableCompression: config.Config.Config.Compression,
+	}
+
+	//One dialer per TLS config, so client certificates rotate through connections
+	tlsConfigs := PrepareTLSConfigs(config.Config.Config.TLS)
+	if len(tlsConfigs) == 0 {
+		TestRunner.Dialers = []*websocket.Dialer{&dialer}
+	}
+
+	for _, tlsConfig := range tlsConfigs {
+		tlsDialer := dialer
+		tlsDialer.TLSClientConfig = tlsConfig
+		TestRunner.Dialers = append(TestRunner.Dialers, &tlsDialer)
+	}
 }
 
 //Start starts the tests
@@ -68,37 +177,290 @@ func (r *Runner) Start() {
 	//Prepare data that will be sent to sockets in case any test has a message & replace string
 	handler := DataHandler{}
 
-	r.MaxDataLength = handler.PrepareTestData(config.Config.DataFile, r.TotalCount, r.Tests)
+	var data [][]string
+	if config.Config.DataFile != "" {
+
+		//Sockets replacing dropped ones are not known beforehand, so all rows are read for concurrency stages
+		rows := r.TotalCount
+		if r.ConcurrencyMode {
+			rows = math.MaxInt32
+		}
+
+		var err error
+		data, err = handler.GetCSVData(config.Config.DataFile, rows)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	//Tests of all scenarios & tests nested in repeat tests need data as well
+	allTests := r.AllTests()
+
+	if err := handler.PreparePayloads(allTests); err != nil {
+		panic(err)
+	}
+	r.MaxDataLength = handler.PrepareTestData(data, allTests)
+	handler.PrepareVariables(allTests)
+
+	//Prepare request headers, which can use data as well
+	r.Headers = handler.PrepareHeaders(data, config.Config.Config)
+	if len(r.Headers) > r.MaxDataLength {
+		r.MaxDataLength = len(r.Headers)
+	}
 
 	//Start the error listener
 	go r.ErrorListener()
 
+	//Stop the test on interrupts
+	go r.SignalListener()
+
 	//Start listening to test completions
 	go r.CompleteNotify()
 
+	//Stream the metric of every connection to the event log
+	if config.Config.Output.Events != "" {
+		Reporter.EventLog = NewEventLog(config.Config.Output.Events, config.Config.Output.EventsFormat)
+		go Reporter.EventLog.Start()
+	}
+
 	//Start the reporter
 	go Reporter.Start()
 
 	//Run tests!
-	r.RunTests()
+	if r.ConcurrencyMode {
+		r.RunConcurrency()
+	} else {
+		r.RunTests()
+	}
+
+	//Every socket opened needs to complete
+	if r.ConcurrencyMode || r.Stopped() {
+		r.TotalCount = r.OpenedCount
+	}
+
+	close(r.OpenDoneChan)
+
+	//Release sockets held till the end of the test
+	r.ReleaseHolds()
+}
+
+//ReleaseHolds waits for the hold duration & releases all held sockets, which close their connections
+func (r *Runner) ReleaseHolds() {
+
+	if r.HoldDuration > 0 {
+		localTimer := time.NewTimer(r.HoldDuration)
+		select {
+		case <-localTimer.C:
+		case <-r.StopChan:
+			localTimer.Stop()
+		}
+	}
+
+	close(r.HoldChan)
+}
+
+//SignalListener stops the test on an interrupt, a second interrupt exits right away
+func (r *Runner) SignalListener() {
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	<-signals
+	fmt.Printf("Stopping tests, closing connections within %v. Interrupt again to exit right away\n", r.GracePeriod)
+	r.Stop()
+
+	<-signals
+	os.Exit(1)
+}
+
+//Stop stops opening sockets & running tests, connections are closed & the results are reported within the grace period
+func (r *Runner) Stop() {
+
+	r.StopOnce.Do(func() {
+		close(r.StopChan)
+
+		//Sockets running tests close themselves, sockets done with their tests are closed here
+		go r.CloseIdleSockets()
+
+		//Report whatever has completed if connections don't close in time
+		go func() {
+			localTimer := time.NewTimer(r.GracePeriod)
+			<-localTimer.C
+			r.Finish()
+		}()
+	})
+}
+
+//CloseIdleSockets sends a close frame (code 1001) to sockets done with their tests but still connected, within the grace period
+func (r *Runner) CloseIdleSockets() {
+
+	var closeWait sync.WaitGroup
+
+	r.SocketsLock.Lock()
+	for socket := range r.Sockets {
+		if !socket.Idle() {
+			continue
+		}
+
+		closeWait.Add(1)
+		go func(socket *Socket) {
+			defer closeWait.Done()
+			socket.CloseHandshake(websocket.CloseGoingAway, "", r.GracePeriod)
+		}(socket)
+	}
+	r.SocketsLock.Unlock()
+
+	closeWait.Wait()
+	close(r.IdleClosedChan)
+}
+
+//Stopped checks if the test has been stopped
+func (r *Runner) Stopped() bool {
+
+	select {
+	case <-r.StopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+//Finish tells the reporter that the test is complete, only once
+func (r *Runner) Finish() {
+
+	r.FinishOnce.Do(func() {
+		Reporter.TestDoneChan <- true
+	})
+}
+
+//PrepareScenarios prepares the scenarios connections are spread over. Without scenarios, all connections run the tests
+func (r *Runner) PrepareScenarios() {
+
+	if len(config.Config.Scenarios) == 0 {
+		r.Scenarios = []*models.Scenario{{
+			Name:   "default",
+			Weight: 1,
+			Tests:  r.Tests,
+		}}
+		r.TotalWeight = 1
+		return
+	}
+
+	names := make(map[string]bool)
+	for idx := range config.Config.Scenarios {
+		scenario := &config.Config.Scenarios[idx]
+
+		if scenario.Name == "" {
+			panic(fmt.Sprintf("Scenario at index %d has no name", idx))
+		}
+
+		if names[scenario.Name] {
+			panic(fmt.Sprintf("Duplicate scenario name found: %s", scenario.Name))
+		}
+		names[scenario.Name] = true
+
+		if scenario.Weight <= 0 {
+			panic(fmt.Sprintf("Scenario %s needs a weight greater than 0", scenario.Name))
+		}
+
+		r.TotalWeight += scenario.Weight
+		r.Scenarios = append(r.Scenarios, scenario)
+
+		//Results are broken down per scenario
+		Reporter.MakeScenarioStat(scenario)
+	}
+}
+
+//AllTests gets the tests of all scenarios, along with the tests nested in repeat tests
+func (r *Runner) AllTests() []*models.Test {
+
+	allTests := make([]*models.Test, 0)
+	for _, scenario := range r.Scenarios {
+		allTests = append(allTests, FlattenTests(scenario.Tests)...)
+	}
+
+	return allTests
+}
+
+//PickScenario picks a scenario at random, by the weight of the scenario
+func (r *Runner) PickScenario() *models.Scenario {
+
+	pick := rand.Float64() * r.TotalWeight
+	for _, scenario := range r.Scenarios {
+		pick -= scenario.Weight
+		if pick < 0 {
+			return scenario
+		}
+	}
+
+	//Rounding can leave pick at 0 after the last scenario
+	return r.Scenarios[len(r.Scenarios)-1]
+}
+
+//FlattenTests gets all tests along with the tests nested in repeat tests
+func FlattenTests(tests []*models.Test) []*models.Test {
+
+	allTests := make([]*models.Test, 0, len(tests))
+	for _, test := range tests {
+		allTests = append(allTests, test)
+		if len(test.Steps) > 0 {
+			allTests = append(allTests, FlattenTests(test.Steps)...)
+		}
+	}
+
+	return allTests
+}
+
+//MaxPingPayload is the most bytes a ping payload can have, as control frames are limited to 125 bytes
+const MaxPingPayload = 125
+
+//PrepareSteps checks the settings of tests that would fail on every connection
+func PrepareSteps(tests []*models.Test) {
+
+	for _, test := range tests {
+		if test.Type == "ping" && len(test.PingPayload) > MaxPingPayload {
+			panic(fmt.Sprintf("Ping payload of %v bytes is too long, pings can have at most %v bytes", len(test.PingPayload), MaxPingPayload))
+		} else if test.Type == "repeat" {
+			//Repeating nothing for a duration would spin till the duration is over
+			if len(test.Steps) == 0 {
+				panic("Repeat test needs steps to repeat")
+			}
+
+			if test.Count < 0 {
+				panic(fmt.Sprintf("Repeat test needs a count greater than 0, found: %v", test.Count))
+			}
+
+			if test.Count == 0 && test.Duration <= 0 {
+				panic("Repeat test needs a count or a duration")
+			}
+		}
+	}
 }
 
 //CompleteNotify is notified when a socket test completes
 func (r *Runner) CompleteNotify() {
+
+	openDone := r.OpenDoneChan
 	for {
 		select {
 		case <-r.SocketDoneChan:
-			r.SocketDoneCount++
-			//fmt.Println("Test done for some socket", r.TotalCount, r.SocketDoneCount)
-			if r.SocketDoneCount >= r.TotalCount {
+			//Live sockets are counted from this, for concurrency stages
+			atomic.AddInt64(&r.SocketDoneCount, 1)
+		case <-openDone:
+			//A nil channel blocks, so this is received only once
+			openDone = nil
+			r.OpeningDone = true
+		}
 
-				//Tell reporter that test is completed
-				Reporter.TestDoneChan <- true
+		//fmt.Println("Test done for some socket", r.TotalCount, r.SocketDoneCount)
+		if r.OpeningDone && int(atomic.LoadInt64(&r.SocketDoneCount)) >= r.TotalCount {
 
-				//Notify that tests are completed & program can exit
-				//r.TestDoneChan <- true
-				break
-			}
+			//Tell reporter that test is completed
+			r.Finish()
+
+			//Notify that tests are completed & program can exit
+			//r.TestDoneChan <- true
+			return
 		}
 	}
 }
@@ -135,6 +497,13 @@ func (r *Runner) PrepareBuckets() {
 		//Start connections will be the current connection count
 		rate.StartConnections = currConn
 
+		if r.ConcurrencyMode {
+			r.PrepareStage(idx, rate, counter)
+			counter += rate.Duration
+			currConn = rate.EndConnections
+			continue
+		}
+
 		incrPerSecond := (rate.EndConnections - currConn) / float64(rate.Duration)
 		for i := 0; i < rate.Duration; i++ {
 
@@ -163,6 +532,23 @@ func (r *Runner) PrepareBuckets() {
 	}
 }
 
+//PrepareStage prepares buckets per second of number of live socket connections to keep for a concurrency stage
+func (r *Runner) PrepareStage(idx int, rate models.HitRate, counter int) {
+
+	incrPerSecond := (rate.EndConnections - rate.StartConnections) / float64(rate.Duration)
+	for i := 0; i < rate.Duration; i++ {
+		r.Flows[counter+i] = models.ConnectionBucket{
+			Idx:         idx,
+			Count:       int(math.Round(rate.StartConnections + incrPerSecond*float64(i+1))),
+			IncrementBy: incrPerSecond,
+		}
+	}
+
+	//Sockets replacing dropped ones are only known once the stage is run, so the stage is reported after all sockets complete
+	rate.Connections = math.MaxInt32
+	Reporter.MakeHitRateStat(idx, rate)
+}
+
 //RunTests runs the tests according to the flow
 func (r *Runner) RunTests() {
 
@@ -200,9 +586,14 @@ func (r *Runner) RunTests() {
 				//fmt.Println("Opening socket!", i, perTenMs)
 			}
 
-			//Wait for 10ms
+			//Wait for 10ms, no more sockets are opened once the test is stopped
 			localTimer := time.NewTimer(10 * time.Millisecond)
-			<-localTimer.C
+			select {
+			case <-localTimer.C:
+			case <-r.StopChan:
+				localTimer.Stop()
+				return
+			}
 		}
 
 		//Since shave incr is greater than 0.5, we need to open a socket. This value is mostly very close to 0.99
@@ -212,14 +603,112 @@ func (r *Runner) RunTests() {
 	}
 }
 
+//RunConcurrency keeps the live sockets at the count of the flow, replacing sockets that complete or drop & closing the newest sockets when ramping down
+func (r *Runner) RunConcurrency() {
+
+	//Live sockets start from the end of the previous second
+	var prevCount float64
+
+	for _, flow := range r.Flows {
+
+		//We move towards the count of this second every 10 milliseconds
+		for count := 1; count <= 100; count++ {
+
+			target := int(math.Round(prevCount + (float64(flow.Count)-prevCount)*float64(count)/100))
+			live := r.LiveConnections()
+			for ; live < target; live++ {
+				r.OpenSocket(flow.Idx)
+			}
+
+			if live > target {
+				r.ShedSockets(live - target)
+			}
+
+			//Wait for 10ms, no more sockets are opened once the test is stopped
+			localTimer := time.NewTimer(10 * time.Millisecond)
+			select {
+			case <-localTimer.C:
+			case <-r.StopChan:
+				localTimer.Stop()
+				return
+			}
+		}
+
+		prevCount = float64(flow.Count)
+	}
+}
+
+//LiveConnections gets the number of sockets opened that are yet to complete, sockets being closed to ramp down are not live
+func (r *Runner) LiveConnections() int {
+	return r.OpenedCount - int(atomic.LoadInt64(&r.SocketDoneCount)) - int(atomic.LoadInt64(&r.ShedCount))
+}
+
+//ShedSockets stops the tests of the newest connected sockets for them to be closed, till count sockets are shed
+func (r *Runner) ShedSockets(count int) {
+
+	r.SocketsLock.Lock()
+	sockets := make([]*Socket, 0, len(r.Sockets))
+	for socket := range r.Sockets {
+		sockets = append(sockets, socket)
+	}
+	r.SocketsLock.Unlock()
+
+	sort.Slice(sockets, func(i, j int) bool {
+		return sockets[i].SocketStats.ConnectionID > sockets[j].SocketStats.ConnectionID
+	})
+
+	for _, socket := range sockets {
+		if count == 0 {
+			return
+		}
+
+		//Sockets still dialing aren't tracked yet, & sockets done with their tests are closing anyway
+		if socket.Shed() {
+			atomic.AddInt64(&r.ShedCount, 1)
+			count--
+		}
+	}
+}
+
+//AddSocket tracks a connected socket
+func (r *Runner) AddSocket(socket *Socket) {
+
+	r.SocketsLock.Lock()
+	defer r.SocketsLock.Unlock()
+
+	r.Sockets[socket] = true
+}
+
+//RemoveSocket stops tracking a socket once its connection is closed
+func (r *Runner) RemoveSocket(socket *Socket) {
+
+	r.SocketsLock.Lock()
+	defer r.SocketsLock.Unlock()
+
+	delete(r.Sockets, socket)
+}
+
 //OpenSocket opens a socket.. this was repeated code
 func (r *Runner) OpenSocket(hitIdx int) {
 
+	r.OpenedCount++
+
 	r.DataIndex++
 	if r.DataIndex >= r.MaxDataLength {
 		r.DataIndex = 0
 	}
 
+	var header http.Header
+	if len(r.Headers) > 0 {
+		header = r.Headers[r.DataIndex%len(r.Headers)]
+	}
+
+	dialer := r.Dialers[r.DialerIndex]
+	r.DialerIndex = (r.DialerIndex + 1) % len(r.Dialers)
+
+	//Every connection runs the tests of one scenario
+	scenario := r.PickScenario()
+
 	//Open a socket
-	go SocketRun(r.HostURL, r.ConnectTimeout, r.Tests, r.DataIndex, r.SocketDoneChan, r.ErrChan, hitIdx, Reporter.ReportChan)
+	go SocketRun(dialer, r.HostURL, header, r.ConnectTimeout, scenario, r.OpenedCount, r.DataIndex, r.SocketDoneChan, r.ErrChan, hitIdx, Reporter.ReportChan)
 }
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//PrepareThinkTimes checks the distributions & bounds of sleep tests with a random think time, so no think time is a fixed sleep
+func PrepareThinkTimes(tests []*models.Test) {
+
+	for _, test := range tests {
+		think := test.Think
+		if think == nil {
+			continue
+		}
+
+		if think.Max > 0 && think.Max <= think.Min {
+			panic(fmt.Sprintf("Think time max of %v needs to be greater than the min of %v", time.Duration(think.Max), time.Duration(think.Min)))
+		}
+
+		switch think.Distribution {
+		case "uniform":
+			if think.Max <= 0 {
+				panic("Think time distribution uniform needs a max")
+			}
+		case "normal":
+			if think.StdDev <= 0 {
+				panic("Think time distribution normal needs a stddev greater than 0")
+			}
+		case "exponential":
+			if think.Mean <= think.Min {
+				panic(fmt.Sprintf("Think time distribution exponential needs a mean greater than the min of %v", time.Duration(think.Min)))
+			}
+		default:
+			panic(fmt.Sprintf("Invalid think time distribution found: %s", think.Distribution))
+		}
+	}
+}
+
+//ThinkDuration draws a random think time from the distribution, bound by the min & max if set
+func ThinkDuration(think *models.ThinkTime) time.Duration {
+
+	min := float64(think.Min)
+	max := float64(think.Max)
+	mean := float64(think.Mean)
+
+	var dur float64
+	switch think.Distribution {
+	case "uniform":
+		dur = min + rand.Float64()*(max-min)
+	case "normal":
+		dur = mean + rand.NormFloat64()*float64(think.StdDev)
+	case "exponential":
+		dur = min + rand.ExpFloat64()*(mean-min)
+	}
+
+	dur = math.Max(dur, min)
+	if max > 0 {
+		dur = math.Min(dur, max)
+	}
+
+	return time.Duration(dur)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/phantomvivek/kratos/models"
+)
+
+//TLSVersions maps the config values of the min TLS version
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//PrepareTLSConfigs builds the TLS client configs, one per client certificate to rotate through connections
+func PrepareTLSConfigs(tlsConfig *models.TLSConfig) []*tls.Config {
+
+	if tlsConfig == nil {
+		return nil
+	}
+
+	baseConfig := &tls.Config{
+		ServerName:         tlsConfig.ServerName,
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+	}
+
+	if tlsConfig.MinVersion != "" {
+		version, ok := TLSVersions[tlsConfig.MinVersion]
+		if !ok {
+			panic(fmt.Sprintf("Invalid TLS min version found: %s", tlsConfig.MinVersion))
+		}
+		baseConfig.MinVersion = version
+	}
+
+	if tlsConfig.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(tlsConfig.CAFile)
+		if err != nil {
+			panic(err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			panic(fmt.Sprintf("No certificates found in CA file: %s", tlsConfig.CAFile))
+		}
+		baseConfig.RootCAs = pool
+	}
+
+	clientCerts := tlsConfig.ClientCerts
+	if tlsConfig.CertFile != "" {
+		clientCerts = append([]models.ClientCert{{CertFile: tlsConfig.CertFile, KeyFile: tlsConfig.KeyFile}}, clientCerts...)
+	}
+
+	if len(clientCerts) == 0 {
+		return []*tls.Config{baseConfig}
+	}
+
+	configs := make([]*tls.Config, 0, len(clientCerts))
+	for _, clientCert := range clientCerts {
+		cert, err := tls.LoadX509KeyPair(clientCert.CertFile, clientCert.KeyFile)
+		if err != nil {
+			panic(err)
+		}
+
+		certConfig := baseConfig.Clone()
+		certConfig.Certificates = []tls.Certificate{cert}
+		configs = append(configs, certConfig)
+	}
+
+	return configs
+}
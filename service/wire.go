@@ -0,0 +1,71 @@
+package service
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+//WireCounter counts the bytes read & written on the network connection of a socket, along with the control frames in them
+type WireCounter struct {
+	BytesRead           int64
+	BytesWritten        int64
+	ControlBytesRead    int64
+	ControlBytesWritten int64
+}
+
+//ControlFrameSize is the size of a control frame on the wire, frames sent by clients are masked with 4 more bytes
+func ControlFrameSize(payload int, masked bool) int64 {
+
+	//Control frame payloads are at most 125 bytes, so the header is always 2 bytes
+	size := int64(2 + payload)
+	if masked {
+		size += 4
+	}
+
+	return size
+}
+
+//CountControlRead counts a control frame read, like pongs, pings & close frames from the host. Counters are nil for wss:// hosts
+func (w *WireCounter) CountControlRead(payload int) {
+
+	if w == nil {
+		return
+	}
+
+	atomic.AddInt64(&w.ControlBytesRead, ControlFrameSize(payload, false))
+}
+
+//CountControlWritten counts a control frame written, like pings, pongs & close frames to the host. Counters are nil for wss:// hosts
+func (w *WireCounter) CountControlWritten(payload int) {
+
+	if w == nil {
+		return
+	}
+
+	atomic.AddInt64(&w.ControlBytesWritten, ControlFrameSize(payload, true))
+}
+
+//CountingConn wraps the network connection to count the bytes on the wire, after compression & framing.
+//It sits under TLS for wss:// hosts, so it is only used for ws:// hosts
+type CountingConn struct {
+	net.Conn
+	Counter *WireCounter
+}
+
+//Read reads from the connection & counts the bytes read
+func (c *CountingConn) Read(b []byte) (int, error) {
+
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.Counter.BytesRead, int64(n))
+
+	return n, err
+}
+
+//Write writes to the connection & counts the bytes written
+func (c *CountingConn) Write(b []byte) (int, error) {
+
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.Counter.BytesWritten, int64(n))
+
+	return n, err
+}